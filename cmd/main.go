@@ -3,9 +3,14 @@ package main
 import (
 	"fmt"
 	"github.com/OctAVProject/OctAV/internal/octav/core"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/dynamic"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/static"
 	"github.com/OctAVProject/OctAV/internal/octav/core/daemon"
+	"github.com/OctAVProject/OctAV/internal/octav/core/history"
+	"github.com/OctAVProject/OctAV/internal/octav/core/quarantine"
 	"github.com/OctAVProject/OctAV/internal/octav/gui"
 	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"github.com/OctAVProject/OctAV/internal/octav/report"
 	"github.com/OctAVProject/OctAV/internal/octav/scan"
 	"github.com/jessevdk/go-flags"
 	"os"
@@ -22,8 +27,27 @@ var commandLine struct {
 	Fastscan       bool           `short:"s" long:"fast-scan" description:"Smart scan, looking in most probable places"`
 	Fullscan       bool           `long:"full-scan" description:"Full scan of the system, really time consuming"`
 	Configscan     bool           `long:"config-scan" description:"Look at config files for security issues"`
+	ScanProcesses  bool           `long:"scan-processes" description:"Scans the memory of the running processes with the YARA rules"`
+	Persistence    bool           `long:"persistence-scan" description:"Analyses what is started automatically (cron, systemd, shell profiles, kernel modules...)"`
+	RootkitCheck   bool           `long:"rootkit-check" description:"Looks for hidden processes, kernel modules and files, and for preloaded libraries"`
+	IntegrityCheck bool           `long:"integrity-check" description:"Checks the files of $PATH against the dpkg and rpm databases, and analyses the modified ones"`
 	Sync           bool           `long:"sync" description:"Synchronizes database"`
+	YaraCheck      bool           `long:"yara-check" description:"Compiles every YARA rules file and reports the broken ones"`
 	GUI            bool           `long:"gui" description:"Starts OctAV's Analysis"`
+	QuarantineList bool           `long:"quarantine-list" description:"Lists the files in quarantine"`
+	Restore        string         `long:"restore" value-name:"ID" description:"Restores a quarantined file to its original location"`
+	Purge          string         `long:"purge" value-name:"ID" description:"Definitively deletes a quarantined file"`
+	History        bool           `long:"history" description:"Prints the results of the previous analyses"`
+	Report         string         `long:"report" value-name:"FILE" description:"Writes the results of the analysis to FILE"`
+	ReportFormat   string         `long:"format" description:"Format of the report" choice:"json" choice:"sarif" choice:"html" default:"json"`
+	Policy         string         `long:"policy" value-name:"FILE" description:"Scoring policy (default: /etc/octav/policy.yml)"`
+	Jobs           int            `short:"j" long:"jobs" value-name:"N" description:"Number of files analysed in parallel (default: number of CPUs)"`
+	SandboxJobs    int            `long:"sandbox-jobs" value-name:"N" description:"Number of files analysed by the sandbox at the same time" default:"2"`
+	Excludes       []string       `long:"exclude" value-name:"PATTERN" description:"Skips the files and directories matching the glob (can be repeated)"`
+	OneFileSystem  bool           `long:"one-file-system" description:"Doesn't cross filesystem boundaries while scanning directories"`
+	MaxFileSize    int64          `long:"max-file-size" value-name:"BYTES" description:"Skips the files bigger than BYTES"`
+	MaxDepth       int            `long:"max-depth" value-name:"N" description:"Doesn't go more than N directories deep"`
+	NoCache        bool           `long:"no-cache" description:"Analyses every file again, even the ones that haven't changed since they were found clean"`
 	PositionalArgs positionalArgs `positional-args:"true"`
 }
 
@@ -44,6 +68,24 @@ func main() {
 		logger.Fatal("You cannot use --gui and --daemon together")
 	}
 
+	if commandLine.Policy != "" {
+		core.PolicyPath = commandLine.Policy
+	}
+
+	if commandLine.Jobs > 0 {
+		core.DefaultJobs = commandLine.Jobs
+	}
+
+	dynamic.SetMaxSubmissions(commandLine.SandboxJobs)
+	core.NoCache = commandLine.NoCache
+
+	scan.Options = scan.WalkOptions{
+		Excludes:      commandLine.Excludes,
+		OneFileSystem: commandLine.OneFileSystem,
+		MaxFileSize:   commandLine.MaxFileSize,
+		MaxDepth:      commandLine.MaxDepth,
+	}
+
 	if commandLine.Daemon {
 		if err = daemon.Manage("start"); err != nil {
 			logger.Error(err.Error())
@@ -69,8 +111,70 @@ func main() {
 		logger.Fatal(fmt.Sprintf("Can't specify file '%s' when fullscan is used.\n", fileToScan))
 	}
 
+	if commandLine.Report != "" && !commandLine.Fastscan && !commandLine.Fullscan && !commandLine.ScanProcesses && !commandLine.Persistence && !commandLine.RootkitCheck && !commandLine.IntegrityCheck && fileToScan == "" {
+		logger.Fatal("--report can only be used with --fast-scan, --full-scan, --scan-processes, --persistence-scan, --rootkit-check, --integrity-check or a file to scan")
+	}
+
 	logger.SetVerboseLevel(commandLine.Verbose)
 
+	// The quarantine and the history don't rely on the database nor the core
+	if commandLine.QuarantineList {
+		entries, err := quarantine.List()
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+
+		if len(entries) == 0 {
+			logger.Info("The quarantine is empty.")
+		}
+
+		for _, entry := range entries {
+			fmt.Println(entry)
+		}
+
+		return
+	}
+
+	if commandLine.History {
+		store, err := history.Open(true)
+		if err != nil {
+			logger.Fatal("Can't open the history : " + err.Error())
+		}
+
+		records, err := store.Last(0)
+		store.Close()
+
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+
+		if len(records) == 0 {
+			logger.Info("The history is empty.")
+		}
+
+		for _, record := range records {
+			fmt.Println(record)
+		}
+
+		return
+	}
+
+	if commandLine.Restore != "" {
+		if _, err := quarantine.Restore(commandLine.Restore); err != nil {
+			logger.Fatal(err.Error())
+		}
+
+		return
+	}
+
+	if commandLine.Purge != "" {
+		if _, err := quarantine.Purge(commandLine.Purge); err != nil {
+			logger.Fatal(err.Error())
+		}
+
+		return
+	}
+
 	if _, err := os.Stat("files/"); os.IsNotExist(err) || commandLine.Sync {
 		core.SyncDatabase()
 	}
@@ -83,7 +187,27 @@ func main() {
 		return
 	}
 
-	// No need to have the core initialized for a config scan
+	if commandLine.YaraCheck {
+		badRules, err := static.CheckRules()
+
+		for _, badRule := range badRules {
+			fmt.Println(badRule)
+		}
+
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+
+		if len(badRules) == 0 {
+			logger.Info("Every YARA rules file compiles.")
+		} else {
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	// No need to have the core initialized for a config scan nor a YARA check
 
 	if err = core.Initialize(false); err != nil {
 		logger.Fatal("Can't initialize the core : " + err.Error())
@@ -96,18 +220,38 @@ func main() {
 			logger.Info("Bye !")
 		}
 	} else if commandLine.Fastscan {
-		scan.FastScan()
+		writeReport(scan.FastScan())
 	} else if commandLine.Fullscan {
-		scan.FullScan()
+		writeReport(scan.FullScan())
+	} else if commandLine.ScanProcesses {
+		writeReport(core.ScanProcesses())
+	} else if commandLine.Persistence {
+		writeReport(scan.PersistenceScan())
+	} else if commandLine.RootkitCheck {
+		writeReport(core.RootkitCheck())
+	} else if commandLine.IntegrityCheck {
+		writeReport(scan.IntegrityCheck())
 	} else if fileToScan != "" {
 		analysis := core.Analysis{Files: []string{fileToScan}}
 
 		if err = analysis.Start(); err != nil {
 			logger.Fatal(err.Error())
 		}
+
+		writeReport(analysis.Results)
 	}
 
 	if err = core.Stop(); err != nil {
 		logger.Fatal("Can't stop the core properly : " + err.Error())
 	}
 }
+
+func writeReport(results []*core.Result) {
+	if commandLine.Report == "" {
+		return
+	}
+
+	if err := report.Write(commandLine.Report, commandLine.ReportFormat, results); err != nil {
+		logger.Error("Can't write the report : " + err.Error())
+	}
+}
@@ -77,7 +77,22 @@ func StartSandBox() error {
 	return nil
 }
 
+// Limits the number of binaries analysed by LiSa at the same time
+var sandboxSlots = make(chan struct{}, 2)
+
+func SetMaxSubmissions(maxSubmissions int) {
+	if maxSubmissions < 1 {
+		maxSubmissions = 1
+	}
+
+	sandboxSlots = make(chan struct{}, maxSubmissions)
+}
+
 func SendFileToSandBox(exe *analysis.Executable) (map[string]interface{}, error) {
+	slots := sandboxSlots
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
 	var requestBody bytes.Buffer
 
 	writer := multipart.NewWriter(&requestBody)
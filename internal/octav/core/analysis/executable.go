@@ -5,31 +5,23 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
-	"errors"
 	"fmt"
-	"github.com/rakyll/magicmime"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/ssdeep"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/tlsh"
 	"io/ioutil"
-	"unsafe"
 )
 
-// #cgo LDFLAGS: -lfuzzy
-// #include <fuzzy.h>
-// #include <stdlib.h>
-import "C"
-
-var supportedMIME = []string{
-	"application/x-executable",
-	"application/x-sharedlib",
-}
-
 type Executable struct {
-	Filename string
-	Content  []byte
-	MIME     string
-	MD5      string
-	SHA1     string
-	SHA256   string
-	SSDeep   string
+	Filename   string
+	Handler    *Handler
+	Content    []byte
+	MIME       string
+	MD5        string
+	SHA1       string
+	SHA256     string
+	SSDeep     string
+	TLSH       string // Empty when the content is too small or too uniform
+	ImportHash string // Empty for statically linked binaries
 }
 
 func (exe Executable) String() string {
@@ -39,77 +31,58 @@ func (exe Executable) String() string {
 		"MD5:\t\t%s\n"+
 		"SHA1:\t\t%s\n"+
 		"SHA256:\t\t%s\n"+
-		"SSDeep:\t\t%s\n",
+		"SSDeep:\t\t%s\n"+
+		"TLSH:\t\t%s\n"+
+		"Import hash:\t%s\n",
 		exe.Filename, len(exe.Content), exe.MIME,
-		exe.MD5, exe.SHA1, exe.SHA256, exe.SSDeep)
+		exe.MD5, exe.SHA1, exe.SHA256, exe.SSDeep, exe.TLSH, exe.ImportHash)
 }
 
+// LoadExecutable returns a *SkippedError without reading the whole file if it's not supported
 func LoadExecutable(filename string) (*Executable, error) {
-	exe := Executable{Filename: filename}
-	content, err := ioutil.ReadFile(filename)
-	exe.Content = content
+	handler, err := Identify(filename)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if len(exe.Content) == 0 {
-		return nil, errors.New("file is empty")
-	}
-
-	exe.MIME, err = getMIME(exe.Content)
+	content, err := ioutil.ReadFile(filename)
 
 	if err != nil {
 		return nil, err
 	}
 
-	exe.MD5, exe.SHA1, exe.SHA256 = getHashes(exe.Content)
-
-	cFilename := C.CString(exe.Filename)
-	cBufferResult := C.malloc(C.FUZZY_MAX_RESULT)
-
-	defer func() {
-		C.free(unsafe.Pointer(cBufferResult))
-		C.free(unsafe.Pointer(cFilename))
-	}()
-
-	if retCode := C.fuzzy_hash_filename(cFilename, (*C.char)(cBufferResult)); retCode != C.int(0) {
-		return nil, errors.New("can't compute SSDeep hash")
-	}
-
-	exe.SSDeep = C.GoString((*C.char)(cBufferResult))
-	return &exe, nil
+	return newExecutable(filename, handler, content)
 }
 
-func isMIMETypeSupported(MIME string) bool {
-	for _, supported := range supportedMIME {
-		if MIME == supported {
-			return true
-		}
+// LoadMember builds an executable from a file extracted from an archive, name is only used in the reports
+func LoadMember(name string, content []byte) (*Executable, error) {
+	handler, err := IdentifyContent(content)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return false
+	return newExecutable(name, handler, content)
 }
 
-func getMIME(fileContent []byte) (string, error) {
+func newExecutable(filename string, handler *Handler, content []byte) (*Executable, error) {
+	exe := Executable{Filename: filename, Handler: handler, Content: content, MIME: handler.MIME}
+	exe.MD5, exe.SHA1, exe.SHA256 = getHashes(exe.Content)
 
-	if err := magicmime.Open(magicmime.MAGIC_MIME_TYPE | magicmime.MAGIC_SYMLINK | magicmime.MAGIC_ERROR); err != nil {
-		panic(err)
+	if exe.Handler.Checks.Has(CheckSSDeep) {
+		exe.SSDeep = ssdeep.Hash(exe.Content)
 	}
 
-	defer magicmime.Close()
-
-	mimetype, err := magicmime.TypeByBuffer(fileContent)
-
-	if err != nil {
-		panic(err)
+	if exe.Handler.Checks.Has(CheckTLSH) {
+		exe.TLSH, _ = tlsh.Hash(exe.Content)
 	}
 
-	if !isMIMETypeSupported(mimetype) {
-		return "", errors.New(fmt.Sprintf("MIME type '%s' is not supported\n", mimetype))
+	if exe.Handler.Checks.Has(CheckImportHash) {
+		exe.ImportHash = importHash(exe.Content)
 	}
 
-	return mimetype, nil
+	return &exe, nil
 }
 
 func getHashes(fileContent []byte) (string, string, string) {
@@ -0,0 +1,132 @@
+package analysis
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Enough to find the magic of every supported type, tar's being the furthest
+const headerSize = 512
+
+const (
+	elfRelocatable = 1
+	elfExecutable  = 2
+	elfShared      = 3 // Shared libraries and PIE executables
+	elfCore        = 4
+)
+
+// SkippedError means the file doesn't need to be analysed, it's not a failure
+type SkippedError struct {
+	Reason string
+}
+
+func (err *SkippedError) Error() string {
+	return err.Reason
+}
+
+// Identify only reads the header of the file to find the handler in charge of it
+func Identify(filename string) (*Handler, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	header := make([]byte, headerSize)
+	read, err := io.ReadFull(file, header)
+
+	if err == io.EOF {
+		return nil, &SkippedError{"empty file"}
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	return identifyHeader(header[:read], file)
+}
+
+// IdentifyContent is the same as Identify, for files that are already in memory such as the members of an archive
+func IdentifyContent(content []byte) (*Handler, error) {
+	if len(content) == 0 {
+		return nil, &SkippedError{"empty file"}
+	}
+
+	header := content
+
+	if len(header) > headerSize {
+		header = header[:headerSize]
+	}
+
+	return identifyHeader(header, bytes.NewReader(content))
+}
+
+func identifyHeader(header []byte, file io.ReaderAt) (*Handler, error) {
+	for _, handler := range handlers {
+		if handler.Match(header, file) {
+			return handler, nil
+		}
+	}
+
+	if isELF(header) {
+		return nil, &SkippedError{describeELF(header)}
+	}
+
+	return nil, &SkippedError{"unsupported file type"}
+}
+
+func isELF(header []byte) bool {
+	return len(header) >= 4 && string(header[:4]) == "\x7fELF"
+}
+
+// elfType returns e_type, 0 (ET_NONE) if the header is not a valid ELF header
+func elfType(header []byte) uint16 {
+	if !isELF(header) || len(header) < 18 {
+		return 0
+	}
+
+	if header[4] != 1 && header[4] != 2 { // EI_CLASS, 32 or 64 bits
+		return 0
+	}
+
+	switch header[5] { // EI_DATA
+	case 1:
+		return binary.LittleEndian.Uint16(header[16:18])
+	case 2:
+		return binary.BigEndian.Uint16(header[16:18])
+	default:
+		return 0
+	}
+}
+
+// PIE executables are ET_DYN like shared libraries, but they ask for an interpreter
+func hasInterpreter(file io.ReaderAt) bool {
+	elfFile, err := elf.NewFile(file)
+	if err != nil {
+		return false
+	}
+
+	for _, program := range elfFile.Progs {
+		if program.Type == elf.PT_INTERP {
+			return true
+		}
+	}
+
+	return false
+}
+
+func describeELF(header []byte) string {
+	switch elfType := elfType(header); elfType {
+	case 0:
+		return "invalid ELF header"
+	case elfRelocatable:
+		return "ELF relocatable object"
+	case elfCore:
+		return "ELF core dump"
+	default:
+		return fmt.Sprintf("unsupported ELF type (%d)", elfType)
+	}
+}
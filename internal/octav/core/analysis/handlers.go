@@ -0,0 +1,210 @@
+package analysis
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Checks lists the analyses that make sense for a file type
+type Checks uint
+
+const (
+	CheckHashes     Checks = 1 << iota // Known malicious hashes
+	CheckYara                          // YARA rules
+	CheckStrings                       // IOCs (domains, IPs) found in the content
+	CheckSSDeep                        // Similarity with known malwares
+	CheckDynamic                       // Sandbox and ML model, only trained on ELF files
+	CheckMembers                       // The files inside archives are analysed as well
+	CheckStructure                     // Anomalies in the ELF headers, sections and imports
+	CheckTLSH                          // TLSH similarity with known malwares
+	CheckImportHash                    // Imported libraries and symbols shared with known malwares
+)
+
+const CheckAll = CheckHashes | CheckYara | CheckStrings | CheckSSDeep | CheckDynamic | CheckStructure | CheckTLSH | CheckImportHash
+
+func (checks Checks) Has(check Checks) bool {
+	return checks&check != 0
+}
+
+// Handler recognizes a file type from its first bytes, file is only needed when the header is not enough
+type Handler struct {
+	Name   string
+	MIME   string
+	Checks Checks
+	Match  func(header []byte, file io.ReaderAt) bool
+}
+
+var handlers []*Handler
+
+// RegisterHandler adds a file type to the ones being analysed, handlers are tried in the order they have been registered
+func RegisterHandler(handler *Handler) {
+	handlers = append(handlers, handler)
+}
+
+func init() {
+	RegisterHandler(&Handler{
+		Name:   "elf-executable",
+		MIME:   "application/x-executable",
+		Checks: CheckAll,
+		Match: func(header []byte, file io.ReaderAt) bool {
+			return elfType(header) == elfExecutable
+		},
+	})
+
+	RegisterHandler(&Handler{
+		Name:   "elf-pie-executable",
+		MIME:   "application/x-pie-executable",
+		Checks: CheckAll,
+		Match: func(header []byte, file io.ReaderAt) bool {
+			return elfType(header) == elfShared && hasInterpreter(file)
+		},
+	})
+
+	RegisterHandler(&Handler{
+		Name:   "elf-sharedlib",
+		MIME:   "application/x-sharedlib",
+		Checks: CheckAll,
+		Match: func(header []byte, file io.ReaderAt) bool {
+			return elfType(header) == elfShared
+		},
+	})
+
+	scripts := []struct {
+		name         string
+		mime         string
+		interpreters []string
+	}{
+		{"shell-script", "text/x-shellscript", []string{"sh", "bash", "dash", "zsh", "ksh", "ash", "busybox"}},
+		{"python-script", "text/x-python", []string{"python"}},
+		{"perl-script", "text/x-perl", []string{"perl"}},
+		{"ruby-script", "text/x-ruby", []string{"ruby"}},
+		{"php-script", "text/x-php", []string{"php"}},
+		{"node-script", "application/javascript", []string{"node", "nodejs"}},
+	}
+
+	for _, script := range scripts {
+		interpreters := script.interpreters
+
+		RegisterHandler(&Handler{
+			Name:   script.name,
+			MIME:   script.mime,
+			Checks: CheckHashes | CheckYara | CheckStrings,
+			Match: func(header []byte, file io.ReaderAt) bool {
+				interpreter := shebangInterpreter(header)
+
+				for _, prefix := range interpreters {
+					if strings.HasPrefix(interpreter, prefix) {
+						return true
+					}
+				}
+
+				return false
+			},
+		})
+	}
+
+	documents := []struct {
+		name  string
+		mime  string
+		magic string
+	}{
+		{"pdf", "application/pdf", "%PDF-"},
+		{"ole", "application/x-ole-storage", "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"}, // Legacy MS Office documents
+		{"rtf", "text/rtf", `{\rtf`},
+	}
+
+	for _, document := range documents {
+		registerMagic(document.name, document.mime, document.magic, 0, CheckHashes|CheckYara|CheckStrings)
+	}
+
+	archives := []struct {
+		name   string
+		mime   string
+		magic  string
+		offset int
+	}{
+		{"zip", "application/zip", "PK\x03\x04", 0},
+		{"gzip", "application/gzip", "\x1f\x8b", 0},
+		{"bzip2", "application/x-bzip2", "BZh", 0},
+		{"xz", "application/x-xz", "\xfd7zXZ\x00", 0},
+		{"zstd", "application/zstd", "\x28\xb5\x2f\xfd", 0},
+		{"7z", "application/x-7z-compressed", "7z\xbc\xaf\x27\x1c", 0},
+		{"ar", "application/x-archive", "!<arch>\n", 0}, // Debian packages
+		{"rpm", "application/x-rpm", "\xed\xab\xee\xdb", 0},
+		{"tar", "application/x-tar", "ustar", 257},
+	}
+
+	// Apart from its members, the archive itself can only be compared to known hashes and YARA rules
+	for _, archive := range archives {
+		registerMagic(archive.name, archive.mime, archive.magic, archive.offset, CheckHashes|CheckYara|CheckMembers)
+	}
+
+	// PHP files rarely have a shebang, webshells are recognized by their opening tag. Tried last so that an archive or
+	// a document embedding PHP code is still handled as such
+	RegisterHandler(&Handler{
+		Name:   "php-script",
+		MIME:   "text/x-php",
+		Checks: CheckHashes | CheckYara | CheckStrings,
+		Match: func(header []byte, file io.ReaderAt) bool {
+			return hasPHPTag(header)
+		},
+	})
+}
+
+func registerMagic(name string, mime string, magic string, offset int, checks Checks) {
+	RegisterHandler(&Handler{
+		Name:   name,
+		MIME:   mime,
+		Checks: checks,
+		Match: func(header []byte, file io.ReaderAt) bool {
+			return len(header) >= offset+len(magic) && string(header[offset:offset+len(magic)]) == magic
+		},
+	})
+}
+
+// "<?php" can follow some HTML or an image header (GIF89a polyglots) and is case insensitive. The short "<?=" is only
+// trusted at the start of the file
+func hasPHPTag(header []byte) bool {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(header, []byte("\xef\xbb\xbf")), " \t\r\n")
+
+	if bytes.HasPrefix(trimmed, []byte("<?=")) {
+		return true
+	}
+
+	return bytes.Contains(bytes.ToLower(header), []byte("<?php"))
+}
+
+// Handles both "#!/bin/sh" and "#!/usr/bin/env python3"
+func shebangInterpreter(header []byte) string {
+	if !bytes.HasPrefix(header, []byte("#!")) {
+		return ""
+	}
+
+	line := header[2:]
+
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+
+	fields := strings.Fields(string(line))
+
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := filepath.Base(fields[0])
+
+	if interpreter == "env" {
+		for _, argument := range fields[1:] {
+			if !strings.HasPrefix(argument, "-") {
+				return filepath.Base(argument)
+			}
+		}
+
+		return ""
+	}
+
+	return interpreter
+}
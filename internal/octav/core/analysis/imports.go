@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"bytes"
+	"crypto/md5"
+	"debug/elf"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// With fewer imports, unrelated binaries would share the same hash
+const minImports = 5
+
+// importHash is the ELF counterpart of the PE imphash : the MD5 of the needed libraries and imported symbols, sorted so that
+// recompiling or relinking the same code gives the same hash. Statically linked binaries have none.
+func importHash(content []byte) string {
+	file, err := elf.NewFile(bytes.NewReader(content))
+	if err != nil {
+		return ""
+	}
+
+	defer file.Close()
+
+	symbols, err := file.ImportedSymbols()
+	if err != nil || len(symbols) < minImports {
+		return ""
+	}
+
+	libraries, _ := file.ImportedLibraries()
+
+	var imports []string
+
+	for _, library := range libraries {
+		imports = append(imports, strings.ToLower(library))
+	}
+
+	sort.Strings(imports)
+
+	names := make(map[string]bool)
+
+	for _, symbol := range symbols {
+		names[strings.ToLower(symbol.Name)] = true
+	}
+
+	var sortedNames []string
+
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+
+	sort.Strings(sortedNames)
+	imports = append(imports, sortedNames...)
+
+	hash := md5.Sum([]byte(strings.Join(imports, ",")))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,105 @@
+package integrity
+
+import (
+	"bufio"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stuff that could be put in a config file
+var (
+	dpkgInfoPath       = "/var/lib/dpkg/info/"
+	dpkgDiversionsPath = "/var/lib/dpkg/diversions"
+)
+
+// The diverting package is ":" for the diversions made by the administrator
+const localDiversion = ":"
+
+type diversion struct {
+	divertedTo string
+	by         string
+}
+
+// Every package has an md5sums file listing its files, configuration files excepted, relative to /
+func loadDpkg(database *Database) {
+	md5sums, err := filepath.Glob(filepath.Join(dpkgInfoPath, "*.md5sums"))
+
+	if err != nil || len(md5sums) == 0 {
+		logger.Debug("No dpkg database found")
+		return
+	}
+
+	diversions := loadDiversions()
+
+	for _, filename := range md5sums {
+		// Named PACKAGE.md5sums, or PACKAGE:ARCH.md5sums for the multi-arch packages
+		name := strings.TrimSuffix(filepath.Base(filename), ".md5sums")
+		name = strings.SplitN(name, ":", 2)[0]
+
+		if err := loadMd5sums(database, filename, name, diversions); err != nil {
+			logger.Warning("Can't read " + filename + " : " + err.Error())
+		}
+	}
+}
+
+func loadMd5sums(database *Database, filename string, name string, diversions map[string]diversion) error {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// 32 hexadecimal characters, then two spaces before the path, which can contain spaces
+		if len(line) < 35 {
+			continue
+		}
+
+		path := "/" + strings.TrimLeft(line[32:], " ")
+
+		// The file of the package has been moved aside, another one took its place
+		if diverted, found := diversions[path]; found && diverted.by != name {
+			path = diverted.divertedTo
+		}
+
+		database.add(path, &PackageFile{Package: name, Manager: "dpkg", Algorithm: "md5", Digest: line[:32]})
+	}
+
+	return scanner.Err()
+}
+
+// The diversions file is made of blocks of three lines : the diverted path, where it's been moved and the package
+// that diverted it
+func loadDiversions() map[string]diversion {
+	diversions := make(map[string]diversion)
+
+	file, err := os.Open(dpkgDiversionsPath)
+
+	if err != nil {
+		return diversions
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	scanner := bufio.NewScanner(file)
+	var block []string
+
+	for scanner.Scan() {
+		block = append(block, scanner.Text())
+
+		if len(block) == 3 {
+			diversions[block[0]] = diversion{divertedTo: block[1], by: block[2]}
+			block = nil
+		}
+	}
+
+	return diversions
+}
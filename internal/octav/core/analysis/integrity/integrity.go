@@ -0,0 +1,146 @@
+package integrity
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// PackageFile is a file installed by a package, as recorded by the package manager
+type PackageFile struct {
+	Package   string
+	Manager   string // dpkg or rpm
+	Algorithm string // md5, sha1, sha224, sha256, sha384 or sha512
+	Digest    string // Hexadecimal
+}
+
+func (file *PackageFile) String() string {
+	return fmt.Sprintf("%s (%s)", file.Package, file.Manager)
+}
+
+// Database gathers the files of the packages installed in some directories, by their path once the symbolic links
+// are resolved (with merged /usr, dpkg records /bin/ls but the file is /usr/bin/ls)
+type Database struct {
+	directories map[string]bool
+	files       map[string]*PackageFile
+
+	resolved map[string]string // Directory -> directory once the symbolic links are resolved
+	mutex    sync.Mutex
+}
+
+var newHash = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// Load reads the databases of dpkg and rpm, only the files in the given directories are kept
+func Load(directories []string) *Database {
+	database := &Database{
+		directories: make(map[string]bool),
+		files:       make(map[string]*PackageFile),
+		resolved:    make(map[string]string),
+	}
+
+	for _, directory := range directories {
+		database.directories[database.resolve(directory)] = true
+	}
+
+	loadDpkg(database)
+	loadRpm(database)
+
+	logger.Info(fmt.Sprintf("%v files known to the package managers", len(database.files)))
+	return database
+}
+
+// Kept only if it's in one of the directories of the database
+func (database *Database) add(filename string, file *PackageFile) {
+	filename = database.realPath(filename)
+
+	if database.directories[filepath.Dir(filename)] {
+		database.files[filename] = file
+	}
+}
+
+// Lookup returns the package owning the file, nil if it's not owned by any package
+func (database *Database) Lookup(filename string) *PackageFile {
+	if database == nil {
+		return nil
+	}
+
+	return database.files[database.realPath(filename)]
+}
+
+// Files returns the path of every file of the database, sorted
+func (database *Database) Files() []string {
+	var files []string
+
+	for filename := range database.files {
+		files = append(files, filename)
+	}
+
+	sort.Strings(files)
+	return files
+}
+
+func (database *Database) realPath(filename string) string {
+	return filepath.Join(database.resolve(filepath.Dir(filename)), filepath.Base(filename))
+}
+
+// Only the directories are resolved, a package can install a symbolic link as well as the file it leads to
+func (database *Database) resolve(directory string) string {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	if resolved, found := database.resolved[directory]; found {
+		return resolved
+	}
+
+	resolved, err := filepath.EvalSymlinks(directory)
+
+	if err != nil {
+		resolved = filepath.Clean(directory)
+	}
+
+	database.resolved[directory] = resolved
+	return resolved
+}
+
+// Intact tells whether the file on disk is the one installed by the package
+func (file *PackageFile) Intact(filename string) (bool, error) {
+	newDigest, supported := newHash[file.Algorithm]
+
+	if !supported {
+		return false, errors.New(fmt.Sprintf("unsupported digest algorithm %s for %s", file.Algorithm, filename))
+	}
+
+	content, err := os.Open(filename)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer content.Close() // No need to handle error, file in read only
+
+	digest := newDigest()
+
+	if _, err = io.Copy(digest, content); err != nil {
+		return false, err
+	}
+
+	return hex.EncodeToString(digest.Sum(nil)) == file.Digest, nil
+}
@@ -0,0 +1,69 @@
+package integrity
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Stuff that could be put in a config file
+var rpmCommand = "rpm"
+
+// One line per file : package, flags, digest algorithm, digest and path. The scalar tags are repeated with "="
+const rpmQueryFormat = `[%{=NAME}\t%{FILEFLAGS}\t%{=FILEDIGESTALGO}\t%{FILEDIGESTS}\t%{FILENAMES}\n]`
+
+// Flag of the configuration files, they are meant to be modified
+const rpmConfigFile = 1
+
+// PGP hash algorithm identifiers, packages older than rpm 4.6 have no algorithm and use md5
+var rpmDigestAlgorithms = map[string]string{
+	"1":      "md5",
+	"2":      "sha1",
+	"8":      "sha256",
+	"9":      "sha384",
+	"10":     "sha512",
+	"11":     "sha224",
+	"(none)": "md5",
+}
+
+// The rpm database format changed over time (Berkeley DB, NDB, SQLite), rpm itself is the only reliable way to read it
+func loadRpm(database *Database) {
+	if _, err := exec.LookPath(rpmCommand); err != nil {
+		logger.Debug("No rpm database found")
+		return
+	}
+
+	output, err := exec.Command(rpmCommand, "-qa", "--queryformat", rpmQueryFormat).Output()
+
+	if err != nil {
+		logger.Warning("Can't query the rpm database : " + err.Error())
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 5)
+
+		// Directories and symbolic links have no digest
+		if len(fields) != 5 || fields[3] == "" {
+			continue
+		}
+
+		if flags, err := strconv.Atoi(fields[1]); err != nil || flags&rpmConfigFile != 0 {
+			continue
+		}
+
+		algorithm, supported := rpmDigestAlgorithms[fields[2]]
+
+		if !supported {
+			logger.Debug("Unsupported digest algorithm " + fields[2] + " for " + fields[4])
+			continue
+		}
+
+		database.add(fields[4], &PackageFile{Package: fields[0], Manager: "rpm", Algorithm: algorithm, Digest: fields[3]})
+	}
+}
@@ -0,0 +1,284 @@
+package rootkit
+
+import (
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Stuff that could be put in a config file
+var (
+	loadedModulesPath = "/proc/modules"
+	sysModulePath     = "/sys/module/"
+	// Where rootkits usually drop their files
+	checkedDirectories = []string{"/", "/bin", "/sbin", "/usr/bin", "/usr/sbin", "/lib", "/usr/lib", "/etc", "/dev", "/dev/shm", "/tmp", "/var/tmp", "/lib/udev"}
+	// Files of well-known rootkits (Azazel, Jynx, Reptile), they hide them from the directory listings
+	knownRootkitFiles = []string{"/etc/ld.so.preload", "/XxJynx", "/reptile", "/lib/udev/reptile"}
+)
+
+// Filesystems where the link count of a directory is 2 + its number of subdirectories
+var directoryLinksFilesystems = map[int64]string{
+	0xEF53:     "ext2/3/4",
+	0x58465342: "xfs",
+	0x01021994: "tmpfs",
+}
+
+// HiddenModules compares the loaded modules of /proc/modules with the ones of /sys/module, a rootkit usually removes
+// itself from one of them only
+func HiddenModules() []Anomaly {
+	logger.Info("Looking for hidden kernel modules...")
+
+	loaded, err := loadedModules()
+
+	if os.IsNotExist(err) {
+		logger.Warning("The kernel doesn't support modules, or they are not visible from here")
+		return nil
+	}
+
+	if err != nil {
+		logger.Error("Can't list the kernel modules : " + err.Error())
+		return nil
+	}
+
+	inSysfs, err := sysfsModules()
+
+	if err != nil {
+		logger.Error("Can't list the kernel modules : " + err.Error())
+		return nil
+	}
+
+	candidates := compareModules(loaded, inSysfs)
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Modules loaded or unloaded between the two listings are ruled out by a second look
+	if loaded, err = loadedModules(); err != nil {
+		logger.Error("Can't list the kernel modules : " + err.Error())
+		return nil
+	}
+
+	if inSysfs, err = sysfsModules(); err != nil {
+		logger.Error("Can't list the kernel modules : " + err.Error())
+		return nil
+	}
+
+	confirmed := make(map[Anomaly]bool)
+
+	for _, anomaly := range compareModules(loaded, inSysfs) {
+		confirmed[anomaly] = true
+	}
+
+	var anomalies []Anomaly
+
+	for _, anomaly := range candidates {
+		if confirmed[anomaly] {
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+
+	return anomalies
+}
+
+func loadedModules() (map[string]bool, error) {
+	content, err := ioutil.ReadFile(loadedModulesPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]bool)
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			loaded[fields[0]] = true
+		}
+	}
+
+	return loaded, nil
+}
+
+// Built-in modules are in /sys/module too, only the loadable ones have an initstate
+func sysfsModules() (map[string]bool, error) {
+	entries, err := ioutil.ReadDir(sysModulePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	inSysfs := make(map[string]bool)
+
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(sysModulePath, entry.Name(), "initstate")); err == nil {
+			inSysfs[entry.Name()] = true
+		}
+	}
+
+	return inSysfs, nil
+}
+
+func compareModules(loaded map[string]bool, inSysfs map[string]bool) []Anomaly {
+	var missingFromProc, missingFromSysfs []string
+
+	for module := range inSysfs {
+		if !loaded[module] {
+			missingFromProc = append(missingFromProc, module)
+		}
+	}
+
+	for module := range loaded {
+		if !inSysfs[module] {
+			missingFromSysfs = append(missingFromSysfs, module)
+		}
+	}
+
+	sort.Strings(missingFromProc)
+	sort.Strings(missingFromSysfs)
+
+	var anomalies []Anomaly
+
+	for _, module := range missingFromProc {
+		anomalies = append(anomalies, Anomaly{Check: CheckHiddenModule, Subject: module, Evidence: "Missing from " + loadedModulesPath})
+	}
+
+	for _, module := range missingFromSysfs {
+		anomalies = append(anomalies, Anomaly{Check: CheckHiddenModule, Subject: module, Evidence: "Missing from " + sysModulePath})
+	}
+
+	return anomalies
+}
+
+// HiddenFiles looks for the discrepancies between what getdents (directory listings) and stat return : known rootkit
+// files that can be stat'ed but are not listed, listed files that can't be stat'ed, and directories whose link count
+// tells they have more subdirectories than listed
+func HiddenFiles() []Anomaly {
+	logger.Info("Looking for hidden files...")
+
+	var anomalies []Anomaly
+
+	for _, filename := range knownRootkitFiles {
+		if _, err := os.Lstat(filename); err != nil {
+			continue
+		}
+
+		if listed, err := isListed(filename); err == nil && !listed {
+			anomalies = append(anomalies, Anomaly{Check: CheckHiddenFile, Subject: filename, Evidence: "Exists but missing from the listing of its directory"})
+		}
+	}
+
+	for _, directory := range checkedDirectories {
+		anomalies = append(anomalies, checkDirectory(directory)...)
+	}
+
+	return anomalies
+}
+
+func isListed(filename string) (bool, error) {
+	names, err := listNames(filepath.Dir(filename))
+
+	if err != nil {
+		return false, err
+	}
+
+	return names[filepath.Base(filename)], nil
+}
+
+func listNames(directory string) (map[string]bool, error) {
+	file, err := os.Open(directory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	names, err := file.Readdirnames(-1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool)
+
+	for _, name := range names {
+		listed[name] = true
+	}
+
+	return listed, nil
+}
+
+func checkDirectory(directory string) []Anomaly {
+	names, err := listNames(directory)
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(fmt.Sprintf("Can't list %s : %s", directory, err.Error()))
+		}
+
+		return nil
+	}
+
+	var anomalies []Anomaly
+
+	for name := range names {
+		filename := filepath.Join(directory, name)
+
+		// Rootkits hooking stat but not getdents, files deleted meanwhile are ruled out by a second look
+		if _, err := os.Lstat(filename); os.IsNotExist(err) {
+			if listed, err := isListed(filename); err == nil && listed {
+				anomalies = append(anomalies, Anomaly{Check: CheckHiddenFile, Subject: filename, Evidence: "Listed but can't be stat'ed"})
+			}
+		}
+	}
+
+	// Subdirectories created meanwhile are ruled out by a second look
+	if hiddenSubdirectories(directory) > 0 {
+		if hidden := hiddenSubdirectories(directory); hidden > 0 {
+			anomalies = append(anomalies, Anomaly{
+				Check:    CheckHiddenFile,
+				Subject:  directory,
+				Evidence: fmt.Sprintf("%v subdirectories are missing from its listing according to its link count", hidden),
+			})
+		}
+	}
+
+	return anomalies
+}
+
+// Every subdirectory links back to its parent with "..", on top of its own entry and "."
+func hiddenSubdirectories(directory string) int64 {
+	var (
+		stat   syscall.Stat_t
+		statfs syscall.Statfs_t
+	)
+
+	if syscall.Lstat(directory, &stat) != nil || syscall.Statfs(directory, &statfs) != nil {
+		return 0
+	}
+
+	if _, supported := directoryLinksFilesystems[int64(statfs.Type)]; !supported {
+		return 0
+	}
+
+	entries, err := ioutil.ReadDir(directory)
+
+	if err != nil {
+		return 0
+	}
+
+	subdirectories := 0
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			subdirectories++
+		}
+	}
+
+	return int64(stat.Nlink) - 2 - int64(subdirectories)
+}
@@ -0,0 +1,234 @@
+package rootkit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Stuff that could be put in a config file
+var (
+	procPath      = "/proc/"
+	pidMaxPath    = "/proc/sys/kernel/pid_max"
+	ldPreloadPath = "/etc/ld.so.preload"
+)
+
+// Used when pid_max can't be read, it's the default of the kernel
+const defaultPIDMax = 32768
+
+// Kinds of anomalies
+const (
+	CheckHiddenProcess = "hidden_process"
+	CheckHiddenModule  = "hidden_module"
+	CheckHiddenFile    = "hidden_file"
+	CheckPreload       = "preload"
+)
+
+// Anomaly is something the kernel or the C library hides or lies about, the way rootkits work
+type Anomaly struct {
+	Check    string
+	Subject  string // Process (as /proc/PID), module, file or library concerned
+	Evidence string
+}
+
+func (anomaly Anomaly) String() string {
+	return fmt.Sprintf("[%s] %s : %s", anomaly.Check, anomaly.Subject, anomaly.Evidence)
+}
+
+// HiddenProcesses probes every PID with kill(0) and returns the ones missing from the listing of /proc. Processes
+// started meanwhile are ruled out by a second look
+func HiddenProcesses() []Anomaly {
+	logger.Info("Looking for hidden processes...")
+
+	pidMax := defaultPIDMax
+
+	if content, err := ioutil.ReadFile(pidMaxPath); err == nil {
+		if value, err := strconv.Atoi(strings.TrimSpace(string(content))); err == nil {
+			pidMax = value
+		}
+	}
+
+	listed, err := listedPIDs()
+
+	if err != nil {
+		logger.Error("Can't list the processes : " + err.Error())
+		return nil
+	}
+
+	var candidates []int
+
+	for pid := 1; pid <= pidMax; pid++ {
+		if !listed[pid] && processExists(pid) && !isThread(pid) {
+			candidates = append(candidates, pid)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if listed, err = listedPIDs(); err != nil {
+		logger.Error("Can't list the processes : " + err.Error())
+		return nil
+	}
+
+	var anomalies []Anomaly
+
+	for _, pid := range candidates {
+		if listed[pid] || !processExists(pid) {
+			continue
+		}
+
+		evidence := "Running but missing from " + procPath
+
+		if comm, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "comm")); err == nil {
+			evidence += fmt.Sprintf(" (%s)", strings.TrimSpace(string(comm)))
+		}
+
+		anomalies = append(anomalies, Anomaly{Check: CheckHiddenProcess, Subject: filepath.Join(procPath, strconv.Itoa(pid)), Evidence: evidence})
+	}
+
+	return anomalies
+}
+
+func listedPIDs() (map[int]bool, error) {
+	entries, err := ioutil.ReadDir(procPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pids := make(map[int]bool)
+
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			pids[pid] = true
+		}
+	}
+
+	return pids, nil
+}
+
+// EPERM means the process exists, it just belongs to another user
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// The threads answer to kill(0) too, but only the thread group leaders are listed in /proc
+func isThread(pid int) bool {
+	file, err := os.Open(filepath.Join(procPath, strconv.Itoa(pid), "status"))
+
+	if err != nil {
+		return false
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "Tgid:" {
+			return fields[1] != strconv.Itoa(pid)
+		}
+	}
+
+	return false
+}
+
+// PreloadedLibraries returns the libraries of /etc/ld.so.preload, loaded into every process, and the ones preloaded
+// into the running processes through the LD_PRELOAD variable
+func PreloadedLibraries() []Anomaly {
+	logger.Info("Looking for preloaded libraries...")
+
+	var anomalies []Anomaly
+
+	if content, err := ioutil.ReadFile(ldPreloadPath); err == nil {
+		for _, library := range ParsePreloadFile(content) {
+			anomalies = append(anomalies, Anomaly{Check: CheckPreload, Subject: library, Evidence: "Listed in " + ldPreloadPath})
+		}
+	}
+
+	listed, err := listedPIDs()
+
+	if err != nil {
+		logger.Error("Can't list the processes : " + err.Error())
+		return anomalies
+	}
+
+	users := make(map[string][]int) // Library -> processes preloading it
+
+	for pid := range listed {
+		// Only readable for the processes of the same user, or by root
+		environ, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "environ"))
+
+		if err != nil {
+			continue
+		}
+
+		for _, variable := range bytes.Split(environ, []byte{0}) {
+			if !bytes.HasPrefix(variable, []byte("LD_PRELOAD=")) {
+				continue
+			}
+
+			// Libraries are separated by spaces or colons
+			for _, library := range strings.FieldsFunc(string(variable[len("LD_PRELOAD="):]), isPreloadSeparator) {
+				users[library] = append(users[library], pid)
+			}
+		}
+	}
+
+	var libraries []string
+
+	for library := range users {
+		libraries = append(libraries, library)
+	}
+
+	sort.Strings(libraries)
+
+	for _, library := range libraries {
+		var pids []string
+
+		sort.Ints(users[library])
+
+		for _, pid := range users[library] {
+			pids = append(pids, strconv.Itoa(pid))
+		}
+
+		anomalies = append(anomalies, Anomaly{
+			Check:    CheckPreload,
+			Subject:  library,
+			Evidence: fmt.Sprintf("Preloaded through LD_PRELOAD by the processes %s", strings.Join(pids, ", ")),
+		})
+	}
+
+	return anomalies
+}
+
+// ParsePreloadFile returns the libraries of /etc/ld.so.preload. Like glibc, the comments run from "#" to the end of
+// the line, and the libraries are separated by spaces, tabs, colons or new lines
+func ParsePreloadFile(content []byte) []string {
+	var libraries []string
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if comment := strings.IndexByte(line, '#'); comment >= 0 {
+			line = line[:comment]
+		}
+
+		libraries = append(libraries, strings.FieldsFunc(line, isPreloadSeparator)...)
+	}
+
+	return libraries
+}
+
+func isPreloadSeparator(c rune) bool {
+	return c == ' ' || c == ':' || c == '\t'
+}
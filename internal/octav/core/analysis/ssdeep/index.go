@@ -0,0 +1,94 @@
+package ssdeep
+
+// Match is the closest known sample found in an Index
+type Match struct {
+	Name  string
+	Score int
+}
+
+type gramKey struct {
+	blockSize uint64
+	gram      string
+}
+
+// Index finds the hashes that can be similar to a given one without comparing it to all of them.
+// Two hashes only get a score when they share a substring of rollingWindow characters computed with the same block size,
+// so indexing these substrings by block size gives every plausible candidate and nothing else.
+type Index struct {
+	signatures []Signature
+	names      []string
+	grams      map[gramKey][]int
+}
+
+func NewIndex() *Index {
+	return &Index{grams: make(map[gramKey][]int)}
+}
+
+func (index *Index) Add(hash string, name string) error {
+	signature, err := Parse(hash)
+	if err != nil {
+		return err
+	}
+
+	id := len(index.signatures)
+	index.signatures = append(index.signatures, signature)
+	index.names = append(index.names, name)
+
+	index.addGrams(signature.Hash1, signature.BlockSize, id)
+	index.addGrams(signature.Hash2, signature.BlockSize*2, id)
+
+	return nil
+}
+
+func (index *Index) addGrams(hash string, blockSize uint64, id int) {
+	seen := make(map[string]bool)
+
+	for i := 0; i+rollingWindow <= len(hash); i++ {
+		gram := hash[i : i+rollingWindow]
+
+		if seen[gram] {
+			continue
+		}
+
+		seen[gram] = true
+		key := gramKey{blockSize, gram}
+		index.grams[key] = append(index.grams[key], id)
+	}
+}
+
+func (index *Index) Len() int {
+	return len(index.signatures)
+}
+
+// Closest returns the most similar known sample, found is false when none of them has a score above 0
+func (index *Index) Closest(hash string) (match Match, found bool, err error) {
+	signature, err := Parse(hash)
+	if err != nil {
+		return Match{}, false, err
+	}
+
+	candidates := make(map[int]bool)
+
+	index.collectCandidates(signature.Hash1, signature.BlockSize, candidates)
+	index.collectCandidates(signature.Hash2, signature.BlockSize*2, candidates)
+
+	for id := range candidates {
+		score := Compare(signature, index.signatures[id])
+
+		// Ties are broken on the name so that the result doesn't depend on the map order
+		if score > match.Score || (score == match.Score && score > 0 && index.names[id] < match.Name) {
+			match = Match{index.names[id], score}
+			found = true
+		}
+	}
+
+	return match, found, nil
+}
+
+func (index *Index) collectCandidates(hash string, blockSize uint64, candidates map[int]bool) {
+	for i := 0; i+rollingWindow <= len(hash); i++ {
+		for _, id := range index.grams[gramKey{blockSize, hash[i : i+rollingWindow]}] {
+			candidates[id] = true
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package ssdeep
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Port of the spamsum algorithm used by ssdeep, see https://ssdeep-project.github.io/ssdeep/
+const (
+	rollingWindow = 7
+	minBlockSize  = 3
+	spamSumLength = 64
+	hashPrime     = 0x01000193
+	hashInit      = 0x28021967
+	base64Chars   = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+type rollingHash struct {
+	window     [rollingWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (roll *rollingHash) update(c byte) uint32 {
+	roll.h2 -= roll.h1
+	roll.h2 += rollingWindow * uint32(c)
+
+	roll.h1 += uint32(c)
+	roll.h1 -= uint32(roll.window[roll.n%rollingWindow])
+
+	roll.window[roll.n%rollingWindow] = c
+	roll.n++
+
+	roll.h3 <<= 5
+	roll.h3 ^= uint32(c)
+
+	return roll.sum()
+}
+
+func (roll *rollingHash) sum() uint32 {
+	return roll.h1 + roll.h2 + roll.h3
+}
+
+func sumHash(c byte, h uint32) uint32 {
+	return (h * hashPrime) ^ uint32(c)
+}
+
+// Hash returns the ssdeep hash of data, formatted as "blocksize:hash:hash"
+func Hash(data []byte) string {
+	blockSize := uint32(minBlockSize)
+
+	for uint64(blockSize)*spamSumLength < uint64(len(data)) {
+		blockSize *= 2
+	}
+
+	for {
+		signature1, signature2, resets := hashWithBlockSize(data, blockSize)
+
+		// Too short to be compared, try again with smaller blocks. Like spamsum, the trailing character doesn't count
+		if blockSize > minBlockSize && resets < spamSumLength/2 {
+			blockSize /= 2
+			continue
+		}
+
+		return fmt.Sprintf("%d:%s:%s", blockSize, signature1, signature2)
+	}
+}
+
+// The number of reset points of the first signature is returned too, it stops counting once the signature is full
+func hashWithBlockSize(data []byte, blockSize uint32) (string, string, int) {
+	var (
+		roll       rollingHash
+		signature1 = make([]byte, 0, spamSumLength)
+		signature2 = make([]byte, 0, spamSumLength/2)
+	)
+
+	h1, h2 := uint32(hashInit), uint32(hashInit)
+
+	// Once full, the last character keeps being replaced
+	set := func(signature []byte, maxLength int, c byte) ([]byte, bool) {
+		if len(signature) == maxLength {
+			signature[maxLength-1] = c
+			return signature, false
+		}
+
+		return append(signature, c), true
+	}
+
+	var (
+		reset  bool
+		resets int
+	)
+
+	for _, c := range data {
+		h1 = sumHash(c, h1)
+		h2 = sumHash(c, h2)
+		rolling := roll.update(c)
+
+		if rolling%blockSize == blockSize-1 {
+			if signature1, reset = set(signature1, spamSumLength, base64Chars[h1%64]); reset && len(signature1) < spamSumLength {
+				h1 = hashInit
+				resets++
+			}
+		}
+
+		if rolling%(blockSize*2) == blockSize*2-1 {
+			if signature2, reset = set(signature2, spamSumLength/2, base64Chars[h2%64]); reset && len(signature2) < spamSumLength/2 {
+				h2 = hashInit
+			}
+		}
+	}
+
+	if roll.sum() != 0 {
+		signature1, _ = set(signature1, spamSumLength, base64Chars[h1%64])
+		signature2, _ = set(signature2, spamSumLength/2, base64Chars[h2%64])
+	}
+
+	return string(signature1), string(signature2), resets
+}
+
+// Signature is a parsed ssdeep hash, ready to be compared
+type Signature struct {
+	BlockSize uint64
+	Hash1     string // Computed with BlockSize
+	Hash2     string // Computed with twice BlockSize
+}
+
+// Parse reads "blocksize:hash:hash", an optional ',"filename"' suffix is ignored
+func Parse(hash string) (Signature, error) {
+	if comma := strings.IndexByte(hash, ','); comma >= 0 {
+		hash = hash[:comma]
+	}
+
+	parts := strings.SplitN(hash, ":", 3)
+
+	if len(parts) != 3 {
+		return Signature{}, errors.New(fmt.Sprintf("invalid ssdeep hash '%s'", hash))
+	}
+
+	blockSize, err := strconv.ParseUint(parts[0], 10, 32)
+
+	if err != nil || blockSize < minBlockSize {
+		return Signature{}, errors.New(fmt.Sprintf("invalid ssdeep block size '%s'", parts[0]))
+	}
+
+	// Long runs of the same character don't tell much about the content and would skew the comparison
+	return Signature{blockSize, eliminateSequences(parts[1]), eliminateSequences(parts[2])}, nil
+}
+
+func eliminateSequences(hash string) string {
+	var eliminated []byte
+
+	for i := 0; i < len(hash); i++ {
+		if i < 3 || hash[i] != hash[i-1] || hash[i] != hash[i-2] || hash[i] != hash[i-3] {
+			eliminated = append(eliminated, hash[i])
+		}
+	}
+
+	return string(eliminated)
+}
+
+// Compare returns a similarity between 0 and 100, hashes can only be compared when their block sizes are close
+func Compare(signature1 Signature, signature2 Signature) int {
+	switch {
+	case signature1.BlockSize == signature2.BlockSize:
+		if signature1.Hash1 == signature2.Hash1 && signature1.Hash2 == signature2.Hash2 {
+			return 100
+		}
+
+		score1 := scoreStrings(signature1.Hash1, signature2.Hash1, signature1.BlockSize)
+		score2 := scoreStrings(signature1.Hash2, signature2.Hash2, signature1.BlockSize*2)
+
+		if score1 > score2 {
+			return score1
+		}
+
+		return score2
+	case signature1.BlockSize == signature2.BlockSize*2:
+		return scoreStrings(signature1.Hash1, signature2.Hash2, signature1.BlockSize)
+	case signature1.BlockSize*2 == signature2.BlockSize:
+		return scoreStrings(signature1.Hash2, signature2.Hash1, signature2.BlockSize)
+	default:
+		return 0
+	}
+}
+
+func scoreStrings(hash1 string, hash2 string, blockSize uint64) int {
+	if len(hash1) > spamSumLength || len(hash2) > spamSumLength {
+		return 0
+	}
+
+	// Unrelated files almost never share a whole window
+	if !haveCommonSubstring(hash1, hash2) {
+		return 0
+	}
+
+	score := uint64(editDistance(hash1, hash2))
+	score = score * spamSumLength / uint64(len(hash1)+len(hash2))
+	score = 100 * score / spamSumLength
+
+	if score >= 100 {
+		return 0
+	}
+
+	score = 100 - score
+
+	// Small block sizes would match too easily, the score is capped by the length of the hashes
+	if blockSize < (99+rollingWindow)/rollingWindow*minBlockSize {
+		shortest := len(hash1)
+		if len(hash2) < shortest {
+			shortest = len(hash2)
+		}
+
+		if maxScore := blockSize / minBlockSize * uint64(shortest); score > maxScore {
+			score = maxScore
+		}
+	}
+
+	return int(score)
+}
+
+func haveCommonSubstring(hash1 string, hash2 string) bool {
+	if len(hash1) < rollingWindow || len(hash2) < rollingWindow {
+		return false
+	}
+
+	windows := make(map[string]bool, len(hash1))
+
+	for i := 0; i+rollingWindow <= len(hash1); i++ {
+		windows[hash1[i:i+rollingWindow]] = true
+	}
+
+	for i := 0; i+rollingWindow <= len(hash2); i++ {
+		if windows[hash2[i:i+rollingWindow]] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Insertions and deletions cost 1, substitutions 2
+func editDistance(s1 string, s2 string) int {
+	previous := make([]int, len(s2)+1)
+	current := make([]int, len(s2)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(s1); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(s2); j++ {
+			substitution := previous[j-1]
+			if s1[i-1] != s2[j-1] {
+				substitution += 2
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(s2)]
+}
+
+func min(values ...int) int {
+	minimum := values[0]
+
+	for _, value := range values[1:] {
+		if value < minimum {
+			minimum = value
+		}
+	}
+
+	return minimum
+}
@@ -0,0 +1,80 @@
+package ssdeep
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The expected hashes come from the reference spamsum implementation, whose output libfuzzy reproduces. The inputs
+// are generated so that the vectors don't need any file: zeros, repeated text and xorshift32 pseudo-random bytes
+var hashVectors = []struct {
+	data []byte
+	hash string
+}{
+	{nil, "3::"},
+	{bytes.Repeat([]byte{0}, 4096), "3::"},
+	{repeatText("OctAV ", 10), "3:9n:9"},
+	{repeatText("OctAV ", 20000), "3:9zmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmzmn:4"},
+	// Random data around the block size boundaries, a block size is used up to 64 times its size
+	{xorshift(2463534242, 191), "3:kEWB4hdtG0vXcOZVpICI/HYBhg9QSfNoVo1MJ/aopGew1jtXxHuWJvrGeMohcyCS:kEhLHrp/I/XvfNoVDJyop9w9Hu6HMW2I"},
+	{xorshift(2463534242, 192), "3:kEWB4hdtG0vXcOZVpICI/HYBhg9QSfNoVo1MJ/aopGew1jtXxHuWJvrGeMohcyCO:kEhLHrp/I/XvfNoVDJyop9w9Hu6HMW2A"},
+	{xorshift(2463534242, 193), "6:kEhLHrp/I/XvfNoVDJyop9w9Hu6HMW25K:kyLpW/fGVDXK99"},
+	{xorshift(2463534242, 383), "6:kEhLHrp/I/XvfNoVDJyop9w9Hu6HMW25MbUw/v4UoqIb99syPixIcolm2DZj8dqT:kyLpW/fGVDXK9x4DqIB9lco5R8JA"},
+	{xorshift(2463534242, 384), "6:kEhLHrp/I/XvfNoVDJyop9w9Hu6HMW25MbUw/v4UoqIb99syPixIcolm2DZj8dqw:kyLpW/fGVDXK9x4DqIB9lco5R8JZ"},
+	{xorshift(2463534242, 385), "6:kEhLHrp/I/XvfNoVDJyop9w9Hu6HMW25MbUw/v4UoqIb99syPixIcolm2DZj8dqP:kyLpW/fGVDXK9x4DqIB9lco5R8JE"},
+	{xorshift(2463534242, 6143), "96:Sa5nsg+cxW5atDDSyXMRcexkzYrCbBRZ+v6nrasUBljTnwVEzwmSntw7gt:Bnx+cc5QDSCecexsYroBRZa62RBlnwGW"},
+	{xorshift(2463534242, 6144), "96:Sa5nsg+cxW5atDDSyXMRcexkzYrCbBRZ+v6nrasUBljTnwVEzwmSntw7gN:Bnx+cc5QDSCecexsYroBRZa62RBlnwG4"},
+	{xorshift(2463534242, 6145), "192:Bnx+cc5QDSCecexsYroBRZa62RBlnwG9UtP2:Bx+FQtfYe/a6yBAP2"},
+	{xorshift(2463534242, 196607), "3072:/VIWcMvZ2eGo1vQTGHQ8Z4pXy/dc6CVhQ0uh4PD3BK7YG072ApwFo5nB:/V5vZ2CZUXEc6Oh4UGDApcodB"},
+	{xorshift(2463534242, 196608), "3072:/VIWcMvZ2eGo1vQTGHQ8Z4pXy/dc6CVhQ0uh4PD3BK7YG072ApwFo5nt:/V5vZ2CZUXEc6Oh4UGDApcodt"},
+	{xorshift(2463534242, 196609), "3072:/VIWcMvZ2eGo1vQTGHQ8Z4pXy/dc6CVhQ0uh4PD3BK7YG072ApwFo5nr:/V5vZ2CZUXEc6Oh4UGDApcodr"},
+	// Inputs having fewer than 32 reset points once their trailing character is excluded, the block size is halved
+	{xorshift(3007713514, 14254), "192:KFGXhAMeWAINBr7pjr7sm5QAezs1zDO1SVQF++A4rjoe+ba68nscM6TSLM:SGW5Ifdjcm2pI1f8bF+zYEe+ba1scjIM"},
+	{xorshift(1274621926, 198574), "3072:CrNOeugbSg4Zc0uIU8gSmB42EbqeT2gcYkgmV4IfAVwBK5jqU9efT8EVE+ViaWwN:a+gb73T8p9HbxT2gcvxBKddILBVliaWC"},
+	{xorshift(1196381047, 25559), "384:nsYCG6rh6npMGa9r4SxX0W5QG9i7y3ytkdnIirw2XJIs+t2rL7iMK5RD4rM6ed6C:nsZkeGa9r50WeH+IsIt2OJ2P+pGY6uKc"},
+	{xorshift(3945980714, 28753), "384:OLNuqqJ1cqb8jWoPRaMYT3f7RSKHBOO2mQ+P78TJL1/fai2MyKpwkN3vzUY5ZTpd:ODqJ1TFQ0PFSKcPJhHXsU3LUY5X2o86l"},
+	{xorshift(1149082574, 15605), "192:aIpRVrFU8Km9mG4U0tNbDn7Qp9wlRnX9vVmd7hy7MVP6+r/o/A+rmsctBpGwOjUX:aICDLG4U0tNbP4whVmbR6wFXpGPU9+16"},
+	{xorshift(4250838207, 3901), "48:w6l65bVgw2UVIA6LkOAMrxwpDlX7MIA2MfgWjcRuDaHu9XBGTx6Oe5p8Szcvq9Gz:wpZgW44lX7E2pWEuzqZeVAycYTCU6ma3"},
+	{xorshift(1288807435, 391), "6:NJB13UZZ0MKSvP1debCQQQrv13hdk+CzfhhqHWalg8150qUmVTd7uD/iY0HeSF:/Bm1HPLoCQjr93hdkJCrg815YLD/6HNF"},
+	{xorshift(103840387, 206438), "3072:mf746z2W4JMAGmjmSmFEtc9HsPy7DTcfLKibkVDkt64yzNCm/F2w3oBC4nF:mf746z2BG0mSRtc+Py3YTpbkVwKDtWI4"},
+}
+
+func xorshift(seed uint32, length int) []byte {
+	data := make([]byte, length)
+
+	for i := range data {
+		seed ^= seed << 13
+		seed ^= seed >> 17
+		seed ^= seed << 5
+		data[i] = byte(seed >> 24)
+	}
+
+	return data
+}
+
+func repeatText(text string, length int) []byte {
+	return bytes.Repeat([]byte(text), length/len(text)+1)[:length]
+}
+
+func TestHash(t *testing.T) {
+	for _, vector := range hashVectors {
+		if hash := Hash(vector.data); hash != vector.hash {
+			t.Errorf("Hash of %v bytes : got %s, expected %s", len(vector.data), hash, vector.hash)
+		}
+	}
+}
+
+func TestCompareIdentical(t *testing.T) {
+	for _, vector := range hashVectors {
+		signature, err := Parse(vector.hash)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Hashes too short to share a window can't be compared, even with themselves
+		if len(signature.Hash1) >= rollingWindow && Compare(signature, signature) != 100 {
+			t.Errorf("%s isn't identical to itself", vector.hash)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package static
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"golang.org/x/net/publicsuffix"
+	"os"
+	"strings"
+)
+
+const domainBlocklistPath = "files/justdomains"
+
+// Stuff that could be put in a config file
+var domainAllowlistPath = "/etc/octav/allowed_domains"
+
+// Domains embedded in many legitimate binaries, a blocklist entry covering them would flag half of the system
+var defaultAllowedDomains = []string{
+	"example.com", "example.org", "example.net",
+	"gnu.org", "kernel.org", "freedesktop.org", "debian.org", "ubuntu.com", "redhat.com", "fedoraproject.org",
+	"python.org", "perl.org", "openssl.org", "mozilla.org", "apache.org", "w3.org", "xml.org",
+	"google.com", "googleapis.com", "microsoft.com", "apple.com", "github.com", "githubusercontent.com",
+	"amazonaws.com", "cloudflare.com", "akamai.net",
+}
+
+// DomainDatabase holds the blocklisted domains, a domain is malicious when it or one of its parents is blocklisted
+type DomainDatabase struct {
+	blocked map[string]bool
+	allowed map[string]bool
+}
+
+// DomainMatch is a domain found in a file, along with the blocklist entry covering it
+type DomainMatch struct {
+	Domain string
+	Entry  string
+}
+
+func (match DomainMatch) String() string {
+	if match.Domain == match.Entry {
+		return match.Domain
+	}
+
+	return fmt.Sprintf("%s (subdomain of %s)", match.Domain, match.Entry)
+}
+
+func NewDomainDatabase() (*DomainDatabase, error) {
+	domainDatabase := &DomainDatabase{
+		blocked: make(map[string]bool),
+		allowed: make(map[string]bool),
+	}
+
+	if err := loadDomains(domainBlocklistPath, domainDatabase.blocked); err != nil {
+		return nil, err
+	}
+
+	for _, domain := range defaultAllowedDomains {
+		domainDatabase.allowed[domain] = true
+	}
+
+	if err := loadDomains(domainAllowlistPath, domainDatabase.allowed); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("%v blocklisted domains loaded, %v allowed", len(domainDatabase.blocked), len(domainDatabase.allowed)))
+	return domainDatabase, nil
+}
+
+func loadDomains(filename string, domains map[string]bool) error {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		domains[normalizeDomain(line)] = true
+	}
+
+	return scanner.Err()
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
+
+// Find returns the blocklisted domains among the ones found in a file
+func (domainDatabase *DomainDatabase) Find(domains []string) []DomainMatch {
+	var matches []DomainMatch
+
+	for _, domain := range domains {
+		if entry, blocked := domainDatabase.lookup(normalizeDomain(domain)); blocked {
+			matches = append(matches, DomainMatch{Domain: domain, Entry: entry})
+		}
+	}
+
+	return matches
+}
+
+// lookup walks up from the domain to its registrable part ("x.evil.co.uk" -> "evil.co.uk"), public suffixes such as
+// "co.uk" or "github.io" are never used, and an allowed domain can't be flagged because of one of its parents
+func (domainDatabase *DomainDatabase) lookup(domain string) (string, bool) {
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+
+	// Many "domains" found in binaries are file names such as "config.json" or "main.cpp"
+	if err != nil || !hasICANNSuffix(domain) {
+		return "", false
+	}
+
+	for candidate := domain; ; {
+		if domainDatabase.allowed[candidate] {
+			return "", false
+		}
+
+		if domainDatabase.blocked[candidate] {
+			return candidate, true
+		}
+
+		if candidate == registrable {
+			return "", false
+		}
+
+		candidate = candidate[strings.IndexByte(candidate, '.')+1:]
+	}
+}
+
+// Private suffixes such as "github.io" are ICANN ones under the hood, what matters is the top level domain
+func hasICANNSuffix(domain string) bool {
+	topLevelDomain := domain[strings.LastIndexByte(domain, '.')+1:]
+	_, icann := publicsuffix.PublicSuffix("domain." + topLevelDomain)
+	return icann
+}
@@ -0,0 +1,244 @@
+package elf
+
+import (
+	"bytes"
+	goelf "debug/elf"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of anomalies, they are used as rule IDs once prefixed by "elf."
+const (
+	RWXSegment         = "rwx_segment"
+	HighEntropy        = "high_entropy"
+	Stripped           = "stripped"
+	NoSectionHeaders   = "no_section_headers"
+	MalformedHeaders   = "malformed_headers"
+	EntryOutsideCode   = "entry_outside_code"
+	UnusualInterpreter = "unusual_interpreter"
+	AntiDebug          = "anti_debug"
+	ReverseShell       = "reverse_shell"
+)
+
+// Below that size, the entropy doesn't mean much
+const minEntropySize = 1024
+
+// The dynamic loaders shipped by glibc and musl, such as /lib64/ld-linux-x86-64.so.2 or /lib/ld-musl-x86_64.so.1
+var systemInterpreter = regexp.MustCompile(`^(/usr)?/lib(32|64|x32)?/([^/]+/)?ld-[^/]+\.so(\.[0-9]+)*$`)
+
+type Anomaly struct {
+	Kind     string
+	Evidence string
+}
+
+// Analyse looks for what is unusual in the structure of an ELF file, sections with an entropy above maxEntropy are considered packed
+func Analyse(content []byte, maxEntropy float64) []Anomaly {
+	file, err := goelf.NewFile(bytes.NewReader(content))
+
+	// The header passed the file type check, a binary that debug/elf can't parse has been crafted
+	if err != nil {
+		return []Anomaly{{MalformedHeaders, "Can't parse the ELF headers : " + err.Error()}}
+	}
+
+	defer file.Close()
+
+	var anomalies []Anomaly
+
+	anomalies = append(anomalies, segmentAnomalies(file, content, maxEntropy)...)
+	anomalies = append(anomalies, sectionAnomalies(file, content, maxEntropy)...)
+	anomalies = append(anomalies, importAnomalies(file)...)
+
+	return anomalies
+}
+
+func segmentAnomalies(file *goelf.File, content []byte, maxEntropy float64) []Anomaly {
+	var anomalies []Anomaly
+
+	for _, program := range file.Progs {
+		switch program.Type {
+		case goelf.PT_LOAD:
+			if program.Flags&(goelf.PF_R|goelf.PF_W|goelf.PF_X) == goelf.PF_R|goelf.PF_W|goelf.PF_X {
+				anomalies = append(anomalies, Anomaly{RWXSegment, fmt.Sprintf("Segment at 0x%x is readable, writable and executable", program.Vaddr)})
+			}
+
+			if program.Off+program.Filesz > uint64(len(content)) {
+				anomalies = append(anomalies, Anomaly{MalformedHeaders, fmt.Sprintf("Segment at 0x%x goes beyond the end of the file", program.Vaddr)})
+			} else if len(file.Sections) <= 1 && program.Filesz >= minEntropySize { // No section to look at
+				if entropy := shannonEntropy(content[program.Off : program.Off+program.Filesz]); entropy > maxEntropy {
+					anomalies = append(anomalies, Anomaly{HighEntropy, fmt.Sprintf("Segment at 0x%x has an entropy of %.2f", program.Vaddr, entropy)})
+				}
+			}
+
+		case goelf.PT_INTERP:
+			interpreter, err := readInterpreter(program)
+
+			if err != nil {
+				anomalies = append(anomalies, Anomaly{MalformedHeaders, "Can't read the interpreter : " + err.Error()})
+			} else if !systemInterpreter.MatchString(interpreter) {
+				anomalies = append(anomalies, Anomaly{UnusualInterpreter, fmt.Sprintf("Loaded by '%s' instead of the system's ld.so", interpreter)})
+			}
+		}
+	}
+
+	return anomalies
+}
+
+func readInterpreter(program *goelf.Prog) (string, error) {
+	if program.Filesz > 4096 {
+		return "", errors.New(fmt.Sprintf("%v bytes long", program.Filesz))
+	}
+
+	interpreter := make([]byte, program.Filesz)
+
+	if _, err := program.ReadAt(interpreter, 0); err != nil {
+		return "", err
+	}
+
+	return string(bytes.TrimRight(interpreter, "\x00")), nil
+}
+
+func sectionAnomalies(file *goelf.File, content []byte, maxEntropy float64) []Anomaly {
+	var anomalies []Anomaly
+
+	// The first section is always the null one
+	if len(file.Sections) <= 1 {
+		return []Anomaly{{NoSectionHeaders, "The section headers have been removed"}}
+	}
+
+	var (
+		hasSymbols      bool
+		entryInCode     bool
+		hasCode         bool
+		unnamedSections int
+	)
+
+	for _, section := range file.Sections[1:] {
+		if section.Name == "" {
+			unnamedSections++
+		}
+
+		if section.Type == goelf.SHT_SYMTAB {
+			hasSymbols = true
+		}
+
+		if section.Flags&goelf.SHF_EXECINSTR != 0 {
+			hasCode = true
+
+			if file.Entry >= section.Addr && file.Entry < section.Addr+section.Size {
+				entryInCode = true
+			}
+		}
+
+		if section.Type == goelf.SHT_NOBITS {
+			continue
+		}
+
+		if section.Offset+section.FileSize > uint64(len(content)) {
+			anomalies = append(anomalies, Anomaly{MalformedHeaders, fmt.Sprintf("Section '%s' goes beyond the end of the file", section.Name)})
+			continue
+		}
+
+		// Packed code is compressed or encrypted, data sections such as hash tables are random anyway
+		if section.Flags&goelf.SHF_EXECINSTR != 0 && section.FileSize >= minEntropySize {
+			entropy := shannonEntropy(content[section.Offset : section.Offset+section.FileSize])
+
+			if entropy > maxEntropy {
+				anomalies = append(anomalies, Anomaly{HighEntropy, fmt.Sprintf("Section '%s' has an entropy of %.2f", section.Name, entropy)})
+			}
+		}
+	}
+
+	if unnamedSections > 0 {
+		anomalies = append(anomalies, Anomaly{MalformedHeaders, fmt.Sprintf("%v sections have no name, the section names table doesn't match", unnamedSections)})
+	}
+
+	if !hasSymbols {
+		anomalies = append(anomalies, Anomaly{Stripped, "No symbol table"})
+	}
+
+	if file.Type == goelf.ET_EXEC || (file.Type == goelf.ET_DYN && file.Entry != 0) {
+		if hasCode && !entryInCode {
+			anomalies = append(anomalies, Anomaly{EntryOutsideCode, fmt.Sprintf("The entry point 0x%x is not in an executable section", file.Entry)})
+		}
+	}
+
+	return anomalies
+}
+
+var (
+	antiDebugFunctions = []string{"ptrace"}
+	networkFunctions   = []string{"socket"}
+	connectFunctions   = []string{"connect", "bind"}
+	spawnFunctions     = []string{"execve", "execl", "execlp", "execle", "execv", "execvp", "execvpe", "system", "popen"}
+	redirectFunctions  = []string{"dup2", "dup3", "fork", "vfork"}
+)
+
+func importAnomalies(file *goelf.File) []Anomaly {
+	var anomalies []Anomaly
+
+	symbols, err := file.ImportedSymbols()
+	if err != nil { // Statically linked
+		return nil
+	}
+
+	imported := make(map[string]bool)
+
+	for _, symbol := range symbols {
+		imported[symbol.Name] = true
+	}
+
+	if found := importedAmong(imported, antiDebugFunctions); len(found) > 0 {
+		anomalies = append(anomalies, Anomaly{AntiDebug, "Imports " + strings.Join(found, ", ")})
+	}
+
+	// Connects a socket to the standard streams of a spawned shell
+	network := importedAmong(imported, networkFunctions)
+	connect := importedAmong(imported, connectFunctions)
+	spawn := importedAmong(imported, spawnFunctions)
+	redirect := importedAmong(imported, redirectFunctions)
+
+	if len(network) > 0 && len(connect) > 0 && len(spawn) > 0 && len(redirect) > 0 {
+		found := append(append(append(network, connect...), redirect...), spawn...)
+		anomalies = append(anomalies, Anomaly{ReverseShell, "Imports " + strings.Join(found, ", ")})
+	}
+
+	return anomalies
+}
+
+func importedAmong(imported map[string]bool, functions []string) []string {
+	var found []string
+
+	for _, function := range functions {
+		if imported[function] {
+			found = append(found, function)
+		}
+	}
+
+	sort.Strings(found)
+	return found
+}
+
+// Between 0 (a single byte value) and 8 (random or compressed data)
+func shannonEntropy(data []byte) float64 {
+	var occurrences [256]int
+
+	for _, b := range data {
+		occurrences[b]++
+	}
+
+	entropy := 0.
+	length := float64(len(data))
+
+	for _, count := range occurrences {
+		if count > 0 {
+			probability := float64(count) / length
+			entropy -= probability * math.Log2(probability)
+		}
+	}
+
+	return entropy
+}
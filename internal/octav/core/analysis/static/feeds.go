@@ -0,0 +1,14 @@
+package static
+
+import (
+	"strings"
+)
+
+// splitFeedLine separates the hash from the optional name of the sample ("<hash> <name>", "<hash>,"<name>""...)
+func splitFeedLine(line string) (string, string) {
+	if separator := strings.IndexAny(line, " \t,;"); separator != -1 {
+		return line[:separator], strings.Trim(strings.TrimSpace(line[separator+1:]), `"`)
+	}
+
+	return line, ""
+}
@@ -0,0 +1,192 @@
+package static
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directories holding the hash feeds, a feed can mix MD5, SHA1 and SHA256 entries
+var hashFeedsPaths = []string{
+	"files/md5_hashes/",
+	"files/sha1_hashes/",
+	"files/sha256_hashes/",
+}
+
+type hashEntry struct {
+	feed uint16 // index in HashDatabase.feeds
+	name string
+}
+
+// HashDatabase keeps every known malicious hash in memory, indexed by its binary form
+type HashDatabase struct {
+	feeds  []string
+	md5    map[[16]byte]hashEntry
+	sha1   map[[20]byte]hashEntry
+	sha256 map[[32]byte]hashEntry
+}
+
+// HashMatch describes which feed entry matched an executable
+type HashMatch struct {
+	Algorithm string
+	Hash      string
+	Feed      string
+	Name      string
+}
+
+func (match HashMatch) String() string {
+	if match.Name != "" {
+		return fmt.Sprintf("%s %s (%s) found in '%s'", match.Algorithm, match.Hash, match.Name, match.Feed)
+	}
+
+	return fmt.Sprintf("%s %s found in '%s'", match.Algorithm, match.Hash, match.Feed)
+}
+
+func NewHashDatabase() (*HashDatabase, error) {
+	hashDatabase := &HashDatabase{
+		md5:    make(map[[16]byte]hashEntry),
+		sha1:   make(map[[20]byte]hashEntry),
+		sha256: make(map[[32]byte]hashEntry),
+	}
+
+	foundFeedDirectory := false
+
+	for _, feedsPath := range hashFeedsPaths {
+		if _, err := os.Stat(feedsPath); os.IsNotExist(err) {
+			logger.Debug("No hash feeds in " + feedsPath)
+			continue
+		}
+
+		foundFeedDirectory = true
+
+		err := filepath.Walk(feedsPath, func(path string, info os.FileInfo, err error) error {
+
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			return hashDatabase.loadFeed(path)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !foundFeedDirectory {
+		return nil, errors.New("no hash feed found in the database")
+	}
+
+	logger.Info(fmt.Sprintf("%v hashes loaded (MD5: %v, SHA1: %v, SHA256: %v)",
+		len(hashDatabase.md5)+len(hashDatabase.sha1)+len(hashDatabase.sha256),
+		len(hashDatabase.md5), len(hashDatabase.sha1), len(hashDatabase.sha256)))
+
+	return hashDatabase, nil
+}
+
+// Lines are either a bare hash or a hash followed by the name of the sample ("<hash> <name>", "<hash>,<name>"...)
+func (hashDatabase *HashDatabase) loadFeed(filename string) error {
+
+	if len(hashDatabase.feeds) > 0xffff {
+		return errors.New("too many hash feeds")
+	}
+
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	entry := hashEntry{feed: uint16(len(hashDatabase.feeds))}
+	hashDatabase.feeds = append(hashDatabase.feeds, filename)
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		hexHash, name := splitFeedLine(line)
+		entry.name = name
+
+		hash, err := hex.DecodeString(hexHash)
+
+		if err != nil {
+			continue // Header or garbage line
+		}
+
+		switch len(hash) {
+		case 16:
+			var key [16]byte
+			copy(key[:], hash)
+			hashDatabase.md5[key] = entry
+		case 20:
+			var key [20]byte
+			copy(key[:], hash)
+			hashDatabase.sha1[key] = entry
+		case 32:
+			var key [32]byte
+			copy(key[:], hash)
+			hashDatabase.sha256[key] = entry
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Lookup returns the first feed entry matching one of the executable's hashes, strongest hash first
+func (hashDatabase *HashDatabase) Lookup(exe *analysis.Executable) (*HashMatch, bool) {
+
+	if hash, err := hex.DecodeString(exe.SHA256); err == nil && len(hash) == 32 {
+		var key [32]byte
+		copy(key[:], hash)
+
+		if entry, found := hashDatabase.sha256[key]; found {
+			return hashDatabase.newMatch("SHA256", exe.SHA256, entry), true
+		}
+	}
+
+	if hash, err := hex.DecodeString(exe.SHA1); err == nil && len(hash) == 20 {
+		var key [20]byte
+		copy(key[:], hash)
+
+		if entry, found := hashDatabase.sha1[key]; found {
+			return hashDatabase.newMatch("SHA1", exe.SHA1, entry), true
+		}
+	}
+
+	if hash, err := hex.DecodeString(exe.MD5); err == nil && len(hash) == 16 {
+		var key [16]byte
+		copy(key[:], hash)
+
+		if entry, found := hashDatabase.md5[key]; found {
+			return hashDatabase.newMatch("MD5", exe.MD5, entry), true
+		}
+	}
+
+	return nil, false
+}
+
+func (hashDatabase *HashDatabase) newMatch(algorithm string, hash string, entry hashEntry) *HashMatch {
+	return &HashMatch{
+		Algorithm: algorithm,
+		Hash:      hash,
+		Feed:      hashDatabase.feeds[entry.feed],
+		Name:      entry.name,
+	}
+}
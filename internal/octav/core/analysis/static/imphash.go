@@ -0,0 +1,68 @@
+package static
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"os"
+	"strings"
+)
+
+const importHashesPath = "files/imphash_hashes.txt"
+
+// ImportHashDatabase maps the import hashes of known malwares to their name
+type ImportHashDatabase struct {
+	hashes map[string]string
+}
+
+// The feed is optional, without it every file is considered unknown
+func NewImportHashDatabase() (*ImportHashDatabase, error) {
+	importHashDatabase := &ImportHashDatabase{hashes: make(map[string]string)}
+
+	file, err := os.Open(importHashesPath)
+
+	if os.IsNotExist(err) {
+		logger.Warning("No import hashes in the database")
+		return importHashDatabase, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		hash, name := splitFeedLine(line)
+
+		if len(hash) != 32 {
+			continue // Header or garbage line
+		}
+
+		importHashDatabase.hashes[strings.ToLower(hash)] = name
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("%v import hashes loaded", len(importHashDatabase.hashes)))
+	return importHashDatabase, nil
+}
+
+// Lookup returns the name of the known sample sharing the imports of the executable
+func (importHashDatabase *ImportHashDatabase) Lookup(exe *analysis.Executable) (string, bool) {
+	if exe.ImportHash == "" {
+		return "", false
+	}
+
+	name, found := importHashDatabase.hashes[exe.ImportHash]
+	return name, found
+}
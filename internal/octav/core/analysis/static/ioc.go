@@ -0,0 +1,190 @@
+package static
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Past that, the file is most likely a dictionary or a certificate bundle, more entries wouldn't help the triage.
+// IPs and domains are not limited, they are all looked up in the blocklists
+const maxIOCsPerKind = 200
+
+// Base64 blobs shorter than that are mostly identifiers and random looking symbols
+const minBase64Length = 40
+
+// In bits per character, encoded text or binary data is above it while concatenated identifiers are below
+const minBase64Entropy = 4.5
+
+// Runs of 5 lowercase letters or 6 digits cover around 5% of random base64
+const maxBase64WordsRatio = 0.3
+
+var (
+	domainRegex = regexp.MustCompile(`([a-zA-Z0-9-_]+\.)*[a-zA-Z0-9][a-zA-Z0-9-_]+\.[a-zA-Z]{2,11}`)
+	wordRegex   = regexp.MustCompile(`[a-z]{5,}|[0-9]{6,}`)
+	urlRegex    = regexp.MustCompile(`\b(?:https?|ftp|tcp|udp|wss?)://[^\s"'<>\x60]+`)
+	emailRegex  = regexp.MustCompile(`\b[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,11}\b`)
+	pathRegex   = regexp.MustCompile(`(?:^|[\s"'=:])(/(?:bin|sbin|boot|dev|etc|home|lib|lib32|lib64|opt|proc|root|run|srv|sys|tmp|usr|var)(?:/[\w.+@-]+)+/?)`)
+	base64Regex = regexp.MustCompile(fmt.Sprintf(`[A-Za-z0-9+/]{%d,}={0,2}`, minBase64Length))
+	walletRegex = regexp.MustCompile(strings.Join([]string{
+		`\b[13][a-km-zA-HJ-NP-Z1-9]{25,34}\b`,  // Bitcoin, legacy addresses
+		`\bbc1[ac-hj-np-z02-9]{11,71}\b`,       // Bitcoin, segwit addresses
+		`\b0x[a-fA-F0-9]{40}\b`,                // Ethereum
+		`\b4[0-9AB][1-9A-HJ-NP-Za-km-z]{93}\b`, // Monero, favoured by cryptominers
+	}, "|"))
+	// Cheap filter, most strings contain none of them
+	commandKeywords = []string{"sh -c", "wget ", "curl ", "chmod ", "/dev/tcp/", "/dev/udp/", "nc ", "ncat ", "crontab", "iptables",
+		"base64 ", "rm -rf", "pkill", "killall", "nohup", "history -c", "setenforce", "useradd", "systemctl "}
+	commandRegex = regexp.MustCompile(`\b(?:sh|bash) -c\b|\b(?:wget|curl) .*https?://|\bchmod [+0-7]*x|/dev/(?:tcp|udp)/|\bnc(?:at)? .*-e\b|\bcrontab\b|\biptables\b|\bbase64 (?:-d|--decode)\b|\brm -rf\b|\bpkill\b|\bkillall\b|\bnohup\b|\bhistory -c\b|\bsetenforce 0\b|\buseradd\b|\bsystemctl (?:stop|disable)\b`)
+)
+
+// IOCs gathers the indicators of compromise found in the strings of a file, to help the triage
+type IOCs struct {
+	URLs     []string `json:",omitempty"`
+	IPs      []string `json:",omitempty"`
+	Domains  []string `json:",omitempty"`
+	Emails   []string `json:",omitempty"`
+	Wallets  []string `json:",omitempty"` // Cryptocurrency addresses
+	Paths    []string `json:",omitempty"`
+	Commands []string `json:",omitempty"` // Whole strings containing shell commands
+	Base64   []string `json:",omitempty"`
+}
+
+func (iocs *IOCs) Empty() bool {
+	return len(iocs.URLs)+len(iocs.IPs)+len(iocs.Domains)+len(iocs.Emails)+len(iocs.Wallets)+len(iocs.Paths)+len(iocs.Commands)+len(iocs.Base64) == 0
+}
+
+// ExtractIOCs looks for IOCs in the ASCII and UTF-16 strings of the content
+func ExtractIOCs(content []byte) *IOCs {
+	strs := ExtractStrings(content)
+
+	// None of the patterns can span several lines, they are all applied at once to the strings
+	text := []byte(strings.Join(strs, "\n"))
+
+	iocs := &IOCs{
+		URLs:   uniqueMatches(urlRegex.FindAll(text, -1), nil),
+		IPs:    extractIPs(text, content),
+		Emails: uniqueMatches(emailRegex.FindAll(text, -1), nil),
+		Base64: uniqueMatches(base64Regex.FindAll(text, -1), isBase64),
+	}
+
+	for _, domain := range domainRegex.FindAll(text, -1) {
+		if domain := normalizeDomain(string(domain)); hasICANNSuffix(domain) {
+			iocs.Domains = append(iocs.Domains, domain)
+		}
+	}
+
+	iocs.Domains = uniqueStrings(iocs.Domains)
+
+	iocs.Wallets = uniqueMatches(walletRegex.FindAll(text, -1), nil)
+
+	var paths [][]byte
+
+	for _, match := range pathRegex.FindAllSubmatch(text, -1) {
+		paths = append(paths, match[1])
+	}
+
+	iocs.Paths = uniqueMatches(paths, nil)
+
+	// The whole string is kept, a command alone doesn't say much
+	for _, str := range strs {
+		if containsAny(str, commandKeywords) && commandRegex.MatchString(str) {
+			iocs.Commands = append(iocs.Commands, str)
+		}
+	}
+
+	iocs.Commands = limitIOCs(uniqueStrings(iocs.Commands))
+
+	return iocs
+}
+
+func uniqueMatches(matches [][]byte, keep func(string) bool) []string {
+	var strs []string
+
+	for _, match := range matches {
+		if str := string(match); keep == nil || keep(str) {
+			strs = append(strs, str)
+		}
+	}
+
+	return limitIOCs(uniqueStrings(strs))
+}
+
+func uniqueStrings(strs []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+
+	for _, str := range strs {
+		if !seen[str] {
+			seen[str] = true
+			unique = append(unique, str)
+		}
+	}
+
+	return unique
+}
+
+func limitIOCs(strs []string) []string {
+	if len(strs) > maxIOCsPerKind {
+		return strs[:maxIOCsPerKind]
+	}
+
+	return strs
+}
+
+// Long runs of letters such as an alphabet or a list of symbol names are valid base64 too, actual blobs decode and look random
+func isBase64(blob string) bool {
+	if len(blob)%4 != 0 || !strings.ContainsAny(blob, "0123456789") {
+		return false
+	}
+
+	if strings.ToLower(blob) == blob || strings.ToUpper(blob) == blob || shannonEntropy(blob) < minBase64Entropy {
+		return false
+	}
+
+	// Concatenated identifiers such as "ArmenianBalineseBopomofo" are mostly made of lowercase words and numbers
+	wordsLength := 0
+
+	for _, bounds := range wordRegex.FindAllStringIndex(blob, -1) {
+		wordsLength += bounds[1] - bounds[0]
+	}
+
+	if float64(wordsLength) > maxBase64WordsRatio*float64(len(blob)) {
+		return false
+	}
+
+	_, err := base64.StdEncoding.DecodeString(blob)
+	return err == nil
+}
+
+func shannonEntropy(str string) float64 {
+	var occurrences [256]int
+
+	for i := 0; i < len(str); i++ {
+		occurrences[str[i]]++
+	}
+
+	entropy := 0.
+	length := float64(len(str))
+
+	for _, count := range occurrences {
+		if count > 0 {
+			probability := float64(count) / length
+			entropy -= probability * math.Log2(probability)
+		}
+	}
+
+	return entropy
+}
+
+func containsAny(str string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(str, substring) {
+			return true
+		}
+	}
+
+	return false
+}
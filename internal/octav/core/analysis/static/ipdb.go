@@ -0,0 +1,273 @@
+package static
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory holding the IP blocklists, a list can mix single IPs and CIDR blocks of both families
+const ipFeedsPath = "files/ip_blocklists/"
+
+type ipEntry struct {
+	network string
+	feed    string
+}
+
+// ipNode is a node of a path compressed binary trie (radix tree), IPv4 addresses are stored as IPv4-mapped IPv6 ones
+type ipNode struct {
+	prefix   [net.IPv6len]byte // Bits after length are zero
+	length   int               // In bits
+	entry    *ipEntry          // nil for the nodes that only branch
+	children [2]*ipNode
+}
+
+// IPDatabase finds the blocklisted network containing an IP in a number of steps bounded by the size of an address
+type IPDatabase struct {
+	root    *ipNode
+	entries int
+}
+
+// IPMatch is an IP found in a file that belongs to a blocklisted network
+type IPMatch struct {
+	IP      string
+	Network string
+	Feed    string
+}
+
+func (match IPMatch) String() string {
+	if match.Network == match.IP {
+		return fmt.Sprintf("%s found in '%s'", match.IP, match.Feed)
+	}
+
+	return fmt.Sprintf("%s (%s) found in '%s'", match.IP, match.Network, match.Feed)
+}
+
+// The feeds are optional, without them no IP is considered malicious
+func NewIPDatabase() (*IPDatabase, error) {
+	ipDatabase := &IPDatabase{}
+
+	if _, err := os.Stat(ipFeedsPath); os.IsNotExist(err) {
+		logger.Warning("No IP blocklist in " + ipFeedsPath)
+		return ipDatabase, nil
+	}
+
+	err := filepath.Walk(ipFeedsPath, func(path string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		return ipDatabase.loadFeed(path)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("%v blocklisted IPs and networks loaded", ipDatabase.entries))
+	return ipDatabase, nil
+}
+
+// Lines start with an IP or a CIDR block, anything after it ("; SBL123", "# comment"...) is ignored
+func (ipDatabase *IPDatabase) loadFeed(filename string) error {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if separator := strings.IndexAny(line, " \t,;#"); separator != -1 {
+			line = line[:separator]
+		}
+
+		prefix, length, err := parseNetwork(line)
+
+		if err != nil {
+			continue // Header or garbage line
+		}
+
+		ipDatabase.insert(prefix, length, &ipEntry{network: line, feed: filename})
+	}
+
+	return scanner.Err()
+}
+
+func parseNetwork(network string) ([net.IPv6len]byte, int, error) {
+	var prefix [net.IPv6len]byte
+
+	if !strings.Contains(network, "/") {
+		ip := net.ParseIP(network)
+
+		if ip == nil {
+			return prefix, 0, errors.New("invalid IP " + network)
+		}
+
+		copy(prefix[:], ip.To16())
+		return prefix, 8 * net.IPv6len, nil
+	}
+
+	ip, ipNet, err := net.ParseCIDR(network)
+
+	if err != nil {
+		return prefix, 0, err
+	}
+
+	ones, bits := ipNet.Mask.Size()
+
+	// The IPv4-mapped prefix takes the first 96 bits
+	if ip.To4() != nil {
+		ones += 8*net.IPv6len - bits
+	}
+
+	copy(prefix[:], ipNet.IP.To16())
+	return prefix, ones, nil
+}
+
+func (ipDatabase *IPDatabase) insert(prefix [net.IPv6len]byte, length int, entry *ipEntry) {
+	link := &ipDatabase.root
+
+	for {
+		node := *link
+
+		if node == nil {
+			*link = &ipNode{prefix: prefix, length: length, entry: entry}
+			ipDatabase.entries++
+			return
+		}
+
+		common := commonPrefixLength(node.prefix, prefix, minInt(node.length, length))
+
+		if common == node.length {
+			if common == length {
+				// Listed by several feeds, the first one is kept
+				if node.entry == nil {
+					node.entry = entry
+					ipDatabase.entries++
+				}
+
+				return
+			}
+
+			link = &node.children[bitAt(prefix, common)]
+			continue
+		}
+
+		// The new network diverges in the middle of the node's prefix, a branching node is needed
+		branch := &ipNode{prefix: maskPrefix(prefix, common), length: common}
+		branch.children[bitAt(node.prefix, common)] = node
+
+		if common == length {
+			branch.entry = entry
+		} else {
+			branch.children[bitAt(prefix, common)] = &ipNode{prefix: prefix, length: length, entry: entry}
+		}
+
+		*link = branch
+		ipDatabase.entries++
+		return
+	}
+}
+
+// lookup returns the most specific network containing the IP
+func (ipDatabase *IPDatabase) lookup(ip net.IP) *ipEntry {
+	var (
+		address [net.IPv6len]byte
+		found   *ipEntry
+	)
+
+	copy(address[:], ip.To16())
+
+	for node := ipDatabase.root; node != nil; {
+		if commonPrefixLength(node.prefix, address, node.length) < node.length {
+			break
+		}
+
+		if node.entry != nil {
+			found = node.entry
+		}
+
+		if node.length == 8*net.IPv6len {
+			break
+		}
+
+		node = node.children[bitAt(address, node.length)]
+	}
+
+	return found
+}
+
+// Find returns the blocklisted IPs among the ones found in a file
+func (ipDatabase *IPDatabase) Find(ips []string) []IPMatch {
+	if ipDatabase.root == nil {
+		return nil
+	}
+
+	var matches []IPMatch
+
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+
+		if parsed == nil {
+			continue
+		}
+
+		if entry := ipDatabase.lookup(parsed); entry != nil {
+			matches = append(matches, IPMatch{IP: ip, Network: entry.network, Feed: entry.feed})
+		}
+	}
+
+	return matches
+}
+
+func bitAt(prefix [net.IPv6len]byte, position int) int {
+	return int(prefix[position/8]>>(7-uint(position%8))) & 1
+}
+
+func commonPrefixLength(prefix1 [net.IPv6len]byte, prefix2 [net.IPv6len]byte, maxLength int) int {
+	for length := 0; length < maxLength; length++ {
+		if bitAt(prefix1, length) != bitAt(prefix2, length) {
+			return length
+		}
+	}
+
+	return maxLength
+}
+
+func maskPrefix(prefix [net.IPv6len]byte, length int) [net.IPv6len]byte {
+	var masked [net.IPv6len]byte
+
+	for position := 0; position < length; position++ {
+		masked[position/8] |= prefix[position/8] & (0x80 >> uint(position%8))
+	}
+
+	return masked
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
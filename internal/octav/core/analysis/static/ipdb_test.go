@@ -0,0 +1,116 @@
+package static
+
+import (
+	"net"
+	"testing"
+)
+
+var ipDatabaseTests = []struct {
+	name     string
+	networks []string // In insertion order
+	entries  int
+	lookups  map[string]string // IP -> most specific network expected, "" when none
+}{
+	{
+		name:     "overlapping networks",
+		networks: []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.1.2.3", "192.168.0.0/16", "10.1.0.0/16"},
+		entries:  5,
+		lookups: map[string]string{
+			"10.200.0.1":    "10.0.0.0/8",
+			"10.1.200.1":    "10.1.0.0/16",
+			"10.1.2.200":    "10.1.2.0/24",
+			"10.1.2.3":      "10.1.2.3",
+			"192.168.1.1":   "192.168.0.0/16",
+			"11.0.0.1":      "",
+			"9.255.255.255": "",
+		},
+	},
+	{
+		name:     "less specific network inserted last",
+		networks: []string{"10.1.2.3", "10.1.2.0/24", "10.1.0.0/16", "10.0.0.0/8"},
+		entries:  4,
+		lookups: map[string]string{
+			"10.1.2.3": "10.1.2.3",
+			"10.1.2.4": "10.1.2.0/24",
+			"10.1.3.1": "10.1.0.0/16",
+			"10.2.0.1": "10.0.0.0/8",
+			"11.1.2.3": "",
+		},
+	},
+	{
+		name:     "sibling networks sharing a branch",
+		networks: []string{"172.16.0.0/24", "172.16.1.0/24", "172.16.0.0/23"},
+		entries:  3,
+		lookups: map[string]string{
+			"172.16.0.1": "172.16.0.0/24",
+			"172.16.1.1": "172.16.1.0/24",
+			"172.16.2.1": "",
+		},
+	},
+	{
+		name:     "IPv4 default route",
+		networks: []string{"203.0.113.0/24", "0.0.0.0/0"},
+		entries:  2,
+		lookups: map[string]string{
+			"203.0.113.7": "203.0.113.0/24",
+			"8.8.8.8":     "0.0.0.0/0",
+			"2001:db8::1": "",
+		},
+	},
+	{
+		name:     "IPv6 default route",
+		networks: []string{"::/0", "2001:db8::/32"},
+		entries:  2,
+		lookups: map[string]string{
+			"2001:db8::1": "2001:db8::/32",
+			"2001:db9::1": "::/0",
+			"8.8.8.8":     "::/0", // Stored as an IPv4-mapped IPv6 address
+		},
+	},
+	{
+		name:     "IPv4 and IPv4-mapped IPv6",
+		networks: []string{"198.51.100.0/24", "::ffff:192.0.2.0/120", "2001:db8::/32"},
+		entries:  3,
+		lookups: map[string]string{
+			"198.51.100.1":        "198.51.100.0/24",
+			"::ffff:198.51.100.1": "198.51.100.0/24",
+			"192.0.2.1":           "::ffff:192.0.2.0/120",
+			"::ffff:192.0.2.1":    "::ffff:192.0.2.0/120",
+			"::198.51.100.1":      "", // IPv4-compatible, not mapped
+			"2001:db8::c633:6401": "2001:db8::/32",
+			"2001:db7::1":         "",
+		},
+	},
+}
+
+func TestIPDatabase(t *testing.T) {
+	for _, test := range ipDatabaseTests {
+		ipDatabase := &IPDatabase{}
+
+		for _, network := range test.networks {
+			prefix, length, err := parseNetwork(network)
+
+			if err != nil {
+				t.Fatalf("%s : %s", test.name, err.Error())
+			}
+
+			ipDatabase.insert(prefix, length, &ipEntry{network: network, feed: test.name})
+		}
+
+		if ipDatabase.entries != test.entries {
+			t.Errorf("%s : %v entries, expected %v", test.name, ipDatabase.entries, test.entries)
+		}
+
+		for ip, expected := range test.lookups {
+			found := ""
+
+			if entry := ipDatabase.lookup(net.ParseIP(ip)); entry != nil {
+				found = entry.network
+			}
+
+			if found != expected {
+				t.Errorf("%s : %s found in '%s', expected '%s'", test.name, ip, found, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package static
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"github.com/hillu/go-yara"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Stuff that could be put in a config file
+var localRulesPath = "/etc/octav/rules.d/"
+
+// Names of the rules to disable, one per line, whatever their namespace
+const disabledRulesFile = "disabled_rules"
+
+// Every local rules file gets its own namespace, such as "local/webshells" for webshells.yar
+const localNamespacePrefix = "local/"
+
+// Digest of the disabled rules file applied to the loaded rules, it may have been modified since
+var appliedDisabledRules string
+
+// localRuleFiles returns the rules files of the local directory, sorted so that the compilation order doesn't change
+func localRuleFiles() []string {
+	entries, err := ioutil.ReadDir(localRulesPath)
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("Can't read the local rules directory : " + err.Error())
+		}
+
+		return nil
+	}
+
+	var filenames []string
+
+	for _, entry := range entries {
+		extension := filepath.Ext(entry.Name())
+
+		if entry.IsDir() || (extension != ".yar" && extension != ".yara") {
+			continue
+		}
+
+		filenames = append(filenames, filepath.Join(localRulesPath, entry.Name()))
+	}
+
+	sort.Strings(filenames)
+	return filenames
+}
+
+func localNamespace(filename string) string {
+	return localNamespacePrefix + strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+}
+
+// localRulesDigest changes whenever a local rules file is added, removed or modified
+func localRulesDigest() string {
+	hash := md5.New()
+
+	for _, filename := range localRuleFiles() {
+		content, err := ioutil.ReadFile(filename)
+
+		if err != nil {
+			logger.Error("Can't read local rules : " + err.Error())
+			continue
+		}
+
+		hash.Write([]byte(filename + "\x00"))
+		hash.Write(content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// disabledRulesDigest changes whenever the disabled rules file is created, removed or modified
+func disabledRulesDigest() string {
+	digest, err := hashFileMD5(filepath.Join(localRulesPath, disabledRulesFile))
+
+	if err != nil {
+		return "none"
+	}
+
+	return digest
+}
+
+func loadDisabledRules() map[string]bool {
+	disabled := make(map[string]bool)
+
+	file, err := os.Open(filepath.Join(localRulesPath, disabledRulesFile))
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("Can't read the disabled rules : " + err.Error())
+		}
+
+		return disabled
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		disabled[line] = true
+	}
+
+	return disabled
+}
+
+// applyLocalOverrides disables the upstream rules redefined by a local rule with the same name, as well as the rules
+// listed in the disabled rules file. The state of every rule is set, the compiled rules may have been saved with an
+// older list
+func applyLocalOverrides(rules *yara.Rules) {
+	appliedDisabledRules = disabledRulesDigest()
+	disabled := loadDisabledRules()
+	allRules := rules.GetRules()
+	overridden := make(map[string]bool)
+
+	for i := range allRules {
+		if strings.HasPrefix(allRules[i].Namespace(), localNamespacePrefix) {
+			overridden[allRules[i].Identifier()] = true
+		}
+	}
+
+	disabledCount := 0
+
+	for i := range allRules {
+		rule := &allRules[i]
+		isLocal := strings.HasPrefix(rule.Namespace(), localNamespacePrefix)
+
+		if disabled[rule.Identifier()] || (!isLocal && overridden[rule.Identifier()]) {
+			rule.Disable()
+			disabledCount++
+		} else {
+			rule.Enable()
+		}
+	}
+
+	if disabledCount > 0 {
+		logger.Info(fmt.Sprintf("%v yara rules disabled or overridden by the local ones", disabledCount))
+	}
+}
@@ -2,102 +2,98 @@ package static
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"github.com/OctAVProject/OctAV/internal/octav/core/analysis"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/ssdeep"
 	"github.com/OctAVProject/OctAV/internal/octav/logger"
 	"os"
-	"path/filepath"
-	"unsafe"
+	"strings"
 )
 
-// #cgo LDFLAGS: -lfuzzy
-// #include <fuzzy.h>
-// #include <stdlib.h>
-import "C"
+const ssdeepHashesPath = "files/ssdeep_hashes.txt"
 
-func IsHashKnownToBeMalicious(exe *analysis.Executable) (bool, error) {
-	logger.Info("Comparing MD5 hash signatures...")
+// Below that size, SSDeep hashes are too short to be meaningful
+const ssdeepMinSize = 4096
 
-	var md5HashesFiles []string
-
-	err := filepath.Walk("files/md5_hashes/", func(path string, info os.FileInfo, err error) error {
+// SSDeepDatabase indexes the known SSDeep hashes so that only the plausible candidates are compared
+type SSDeepDatabase struct {
+	index *ssdeep.Index
+}
 
-		if err != nil {
-			return err
-		}
+// SSDeepMatch is the known sample closest to an executable
+type SSDeepMatch struct {
+	Similarity int
+	Name       string
+}
 
-		if !info.IsDir() {
-			md5HashesFiles = append(md5HashesFiles, path)
-		}
+func (match SSDeepMatch) String() string {
+	return fmt.Sprintf("SSDeep similarity of %v with '%s'", match.Similarity, match.Name)
+}
 
-		return nil
-	})
+// Lines are either a bare hash or a hash followed by the name of the sample, such as the '<hash>,"<name>"' printed by ssdeep
+func NewSSDeepDatabase() (*SSDeepDatabase, error) {
+	file, err := os.Open(ssdeepHashesPath)
 
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	for _, filename := range md5HashesFiles {
-		//logger.Debug(fmt.Sprintf("Opening '%v' ...", filename))
+	defer file.Close() // No need to handle error, file in read only
 
-		file, err := os.OpenFile(filename, os.O_RDONLY, os.ModePerm)
+	ssdeepDatabase := &SSDeepDatabase{index: ssdeep.NewIndex()}
+	scanner := bufio.NewScanner(file)
 
-		if err != nil {
-			return false, err
-		}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
 
-		defer file.Close()
+		if line == "" || line[0] == '#' {
+			continue
+		}
 
-		scanner := bufio.NewScanner(file)
+		hash, name := splitFeedLine(line)
 
-		for scanner.Scan() {
-			if scanner.Text() == exe.MD5 {
-				return true, nil
-			}
+		// Unnamed samples are described by their hash
+		if name == "" {
+			name = hash
 		}
 
-		if scanner.Err() != nil {
-			return false, scanner.Err()
+		if err := ssdeepDatabase.index.Add(hash, name); err != nil {
+			continue // Header or garbage line
 		}
 	}
 
-	return false, nil
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if ssdeepDatabase.index.Len() == 0 {
+		return nil, errors.New("no SSDeep hash found in " + ssdeepHashesPath)
+	}
+
+	logger.Info(fmt.Sprintf("%v SSDeep hashes loaded", ssdeepDatabase.index.Len()))
+	return ssdeepDatabase, nil
 }
 
-func GetHighestSSDeepDistance(exe *analysis.Executable) (int, error) {
+// Closest returns the known sample the most similar to the executable, if any
+func (ssdeepDatabase *SSDeepDatabase) Closest(exe *analysis.Executable) (*SSDeepMatch, bool) {
 	logger.Info("Comparing SSDeep hash signatures...")
 
-	if len(exe.Content) < 4096 {
+	if len(exe.Content) < ssdeepMinSize {
 		logger.Warning("File is too small to use SSDeep")
-		return 0, nil
+		return nil, false
 	}
 
-	filename := "files/ssdeep_hashes.txt"
-
-	file, err := os.OpenFile(filename, os.O_RDONLY, os.ModePerm)
+	match, found, err := ssdeepDatabase.index.Closest(exe.SSDeep)
 
 	if err != nil {
-		return 0, err
+		logger.Error(err.Error())
+		return nil, false
 	}
 
-	defer file.Close()
-
-	cSSDeep := C.CString(exe.SSDeep)
-
-	defer func() {
-		C.free(unsafe.Pointer(cSSDeep))
-	}()
-
-	scanner := bufio.NewScanner(file)
-	highestSSDeepDistance := 0
-
-	for scanner.Scan() {
-		cCurrentSSDeep := C.CString(scanner.Text())
-		distance := int(C.fuzzy_compare(cCurrentSSDeep, cSSDeep))
-
-		if highestSSDeepDistance < distance {
-			highestSSDeepDistance = distance
-		}
+	if !found {
+		return nil, false
 	}
 
-	return highestSSDeepDistance, scanner.Err()
+	return &SSDeepMatch{Similarity: match.Score, Name: match.Name}, true
 }
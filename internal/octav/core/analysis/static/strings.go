@@ -1,53 +1,148 @@
 package static
 
 import (
-	"bufio"
-	"fmt"
-	"github.com/OctAVProject/OctAV/internal/octav/logger"
-	"os"
+	"bytes"
+	"net"
 	"regexp"
 )
 
-func MaliciousIPFound(exeContent []byte) (bool, error) {
-	//TODO : Manager must clean the file first
-	return false, nil
+// Same default as the strings command
+const minStringLength = 4
+
+var (
+	ipv4Regex = regexp.MustCompile(`(?:[0-9]{1,3}\.){3}[0-9]{1,3}`)
+	ipv6Regex = regexp.MustCompile(`[0-9a-fA-F]{0,4}(?::[0-9a-fA-F]{0,4}){2,7}(?:(?:[0-9]{1,3}\.){3}[0-9]{1,3})?`)
+)
+
+// Such as "fe80::1"
+const minIPv6Length = 7
+
+// Size of a struct sockaddr_in : family, port, address and 8 bytes of zeros
+const sockaddrInSize = 16
+
+var sockaddrInZero = make([]byte, 8)
+
+// ExtractStrings returns the printable ASCII strings of the content, followed by the UTF-16 ones
+func ExtractStrings(content []byte) []string {
+	var strs []string
+
+	var current []byte
+
+	flush := func() {
+		if len(current) >= minStringLength {
+			strs = append(strs, string(current))
+		}
+
+		current = current[:0]
+	}
+
+	for _, c := range content {
+		if isPrintable(c) {
+			current = append(current, c)
+		} else {
+			flush()
+		}
+	}
+
+	flush()
+
+	// Characters are 2 bytes long, the second one being zero for ASCII ones. A big-endian reading would find the same
+	// strings shifted by one character, only little-endian is used on Linux anyway
+	for alignment := 0; alignment < 2; alignment++ {
+		for i := alignment; i+1 < len(content); i += 2 {
+			if content[i+1] == 0 && isPrintable(content[i]) {
+				current = append(current, content[i])
+			} else {
+				flush()
+			}
+		}
+
+		flush()
+	}
+
+	return strs
 }
 
-func MaliciousDomainFound(exeContent []byte) (bool, error) {
+func isPrintable(c byte) bool {
+	return (c >= 0x20 && c < 0x7f) || c == '\t'
+}
 
-	domainRegex := regexp.MustCompile(`([a-zA-Z0-9-_]+\.)*[a-zA-Z0-9][a-zA-Z0-9-_]+\.[a-zA-Z]{2,11}`)
-	domains := domainRegex.FindAll(exeContent, -1)
+// extractIPs returns the IPv4 and IPv6 literals found in the text, as well as the addresses of the sockaddr_in structures
+// that have been compiled into the content (connecting to a hardcoded address doesn't need the address as text)
+func extractIPs(text []byte, content []byte) []string {
+	var ips []string
+	seen := make(map[string]bool)
 
-	if len(domains) == 0 {
-		return false, nil
+	add := func(ip net.IP) {
+		if ip == nil || ip.IsUnspecified() || seen[ip.String()] {
+			return
+		}
+
+		seen[ip.String()] = true
+		ips = append(ips, ip.String())
 	}
 
-	for _, domain := range domains {
-		logger.Debug(fmt.Sprintf("Found '%v' in binary", string(domain)))
+	for _, bounds := range ipv4Regex.FindAllIndex(text, -1) {
+		// Part of a longer number such as a version, "1.2.3.4.5" or "11.2.3.4" read from the second digit
+		if isIPCharacter(text, bounds[0]-1) || isIPCharacter(text, bounds[1]) {
+			continue
+		}
+
+		if ip := net.ParseIP(string(text[bounds[0]:bounds[1]])).To4(); ip != nil && ip[0] != 0 {
+			add(ip)
+		}
 	}
 
-	file, err := os.Open("files/justdomains")
-	if err != nil {
-		logger.Error("Error occurred when opening 'justdomains' : " + err.Error())
-		return false, err
+	for _, bounds := range ipv6Regex.FindAllIndex(text, -1) {
+		literal := string(text[bounds[0]:bounds[1]])
+
+		// Short literals such as "7::ff" are mostly found in hexadecimal dumps or C++ symbols
+		if len(literal) < minIPv6Length || isHexCharacter(text, bounds[0]-1) || isHexCharacter(text, bounds[1]) {
+			continue
+		}
+
+		if ip := net.ParseIP(literal); ip != nil && ip.To4() == nil {
+			add(ip)
+		}
 	}
 
-	defer file.Close() // No need to handle error, file in read only
+	// AF_INET is stored in host byte order (little-endian), the port and the address in network byte order. The structure
+	// is aligned on 4 bytes, and only unicast host addresses are kept, anything else is most likely a table of numbers
+	for offset := 0; offset+sockaddrInSize <= len(content); offset += 4 {
+		sockaddr := content[offset : offset+sockaddrInSize]
 
-	scanner := bufio.NewScanner(file)
+		if sockaddr[0] != 2 || sockaddr[1] != 0 || (sockaddr[2] == 0 && sockaddr[3] == 0) {
+			continue
+		}
 
-	for scanner.Scan() {
-		domainInFile := scanner.Text()
+		if sockaddr[4] == 0 || sockaddr[4] >= 224 || sockaddr[7] == 0 {
+			continue
+		}
 
-		for _, domainFoundInExe := range domains {
-			domainFoundInExe := string(domainFoundInExe)
-			if domainInFile == domainFoundInExe {
-				logger.Danger("Malicious domain found.")
-				logger.Debug(domainFoundInExe)
-				return true, nil
-			}
+		if !bytes.Equal(sockaddr[8:], sockaddrInZero) {
+			continue
 		}
+
+		add(net.IPv4(sockaddr[4], sockaddr[5], sockaddr[6], sockaddr[7]).To4())
+	}
+
+	return ips
+}
+
+func isHexCharacter(content []byte, index int) bool {
+	if index < 0 || index >= len(content) {
+		return false
+	}
+
+	c := content[index]
+	return c == ':' || c == '.' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isIPCharacter(content []byte, index int) bool {
+	if index < 0 || index >= len(content) {
+		return false
 	}
 
-	return false, nil
+	c := content[index]
+	return c == '.' || (c >= '0' && c <= '9')
 }
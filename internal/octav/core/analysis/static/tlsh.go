@@ -0,0 +1,105 @@
+package static
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/tlsh"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"os"
+	"strings"
+)
+
+const tlshHashesPath = "files/tlsh_hashes.txt"
+
+type tlshEntry struct {
+	digest tlsh.Digest
+	name   string
+}
+
+// TLSHDatabase holds the TLSH hashes of known malwares, it catches recompiled variants that SSDeep misses
+type TLSHDatabase struct {
+	entries []tlshEntry
+}
+
+// TLSHMatch is the known sample closest to an executable, the lower the distance the more similar they are
+type TLSHMatch struct {
+	Distance int
+	Name     string
+}
+
+func (match TLSHMatch) String() string {
+	return fmt.Sprintf("TLSH distance of %v with '%s'", match.Distance, match.Name)
+}
+
+// The feed is optional, without it every file is considered unknown
+func NewTLSHDatabase() (*TLSHDatabase, error) {
+	tlshDatabase := &TLSHDatabase{}
+
+	file, err := os.Open(tlshHashesPath)
+
+	if os.IsNotExist(err) {
+		logger.Warning("No TLSH hashes in the database")
+		return tlshDatabase, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		hash, name := splitFeedLine(line)
+
+		digest, err := tlsh.Parse(hash)
+		if err != nil {
+			continue // Header or garbage line
+		}
+
+		// Unnamed samples are described by their hash
+		if name == "" {
+			name = hash
+		}
+
+		tlshDatabase.entries = append(tlshDatabase.entries, tlshEntry{digest, name})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("%v TLSH hashes loaded", len(tlshDatabase.entries)))
+	return tlshDatabase, nil
+}
+
+// Closest returns the known sample with the lowest distance to the executable
+func (tlshDatabase *TLSHDatabase) Closest(exe *analysis.Executable) (*TLSHMatch, bool) {
+	if exe.TLSH == "" || len(tlshDatabase.entries) == 0 {
+		return nil, false
+	}
+
+	logger.Info("Comparing TLSH hashes...")
+
+	digest, err := tlsh.Parse(exe.TLSH)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, false
+	}
+
+	var closest *TLSHMatch
+
+	for _, entry := range tlshDatabase.entries {
+		if distance := tlsh.Distance(digest, entry.digest); closest == nil || distance < closest.Distance {
+			closest = &TLSHMatch{Distance: distance, Name: entry.name}
+		}
+	}
+
+	return closest, true
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/OctAVProject/OctAV/internal/octav/core/analysis"
 	"github.com/OctAVProject/OctAV/internal/octav/logger"
@@ -21,6 +23,7 @@ var (
 	pathToRulesIndex    = yaraPath + "index.yar" // TODO : remove
 	idFile              = "MD5_index.id"
 	pathToCompiledRules = "compiled.rules"
+	pathToBadRules      = "bad_rules.json" // Rules files left out of the compiled rules
 )
 
 var namespaces = map[string]string{
@@ -48,98 +51,270 @@ func (yaraMatcher *YaraGrep) GetAllMatchingRules(exe *analysis.Executable) (yara
 func NewYaraMatcher() (*YaraGrep, error) {
 
 	var (
-		err              error
-		rulesHaveChanged = false
-		yaraGrep         *YaraGrep
+		err      error
+		yaraGrep *YaraGrep
+		badRules []BadRule
 	)
 
 	logger.Debug("Initializing the compiler...")
 
-	if rulesHaveChanged, err = haveYaraBeenUpdated(); err != nil {
-		return nil, err
+	currentID := rulesID()
 
-	} else if rulesHaveChanged {
+	if !haveYaraBeenUpdated(currentID) {
+		var rules *yara.Rules
 
-		logger.Debug("Updating the compiled rules...")
+		if rules, err = yara.LoadRules(pathToCompiledRules); err == nil {
+			yaraGrep = &YaraGrep{rules}
 
-		if yaraGrep, err = buildRules(); err != nil {
-			// TODO : load existing rules anyway ?
-			return nil, err
+			if badRules, err = LoadBadRules(); err != nil {
+				logger.Error("Can't read the list of broken rules : " + err.Error())
+			}
+		} else {
+			logger.Error("Failed to load compiled rules : " + err.Error())
 		}
+	}
 
-	} else {
+	if yaraGrep == nil {
+		logger.Debug("Updating the compiled rules...")
 
-		var rules *yara.Rules
-		rules, err = yara.LoadRules(pathToCompiledRules)
+		if yaraGrep, badRules, err = buildRules(); err != nil {
+			logger.Error("Failed to build the rules : " + err.Error())
+
+			// The ID file is left as is, the build will be tried again next time
+			rules, loadErr := yara.LoadRules(pathToCompiledRules)
+
+			if loadErr != nil {
+				return nil, err
+			}
 
-		if err == nil {
+			logger.Warning("Using the last compiled rules instead")
 			yaraGrep = &YaraGrep{rules}
 
-		} else {
-			logger.Error("Failed to load compiled rules : " + err.Error())
-			logger.Debug("Creating new compiled rules...")
+			// The rules left out are the ones of the last successful build, not of this one
+			if badRules, err = LoadBadRules(); err != nil {
+				logger.Error("Can't read the list of broken rules : " + err.Error())
+			}
 
-			if yaraGrep, err = buildRules(); err != nil {
+		} else {
+			if err = yaraGrep.Save(pathToCompiledRules); err != nil {
+				logger.Error("Failed to save the rules set : " + err.Error())
 				return nil, err
 			}
 
-			rulesHaveChanged = true
+			if err = saveBadRules(badRules); err != nil {
+				logger.Error("Can't save the list of broken rules : " + err.Error())
+			}
+
+			createIDFile(idFile, currentID) // Already logged, the rules will just be compiled again
 		}
 	}
 
-	if rulesHaveChanged {
-		if err = yaraGrep.Save(pathToCompiledRules); err != nil {
-			logger.Error("Failed to save the rules set : " + err.Error())
-			return nil, err
-		}
+	if len(badRules) > 0 {
+		logger.Warning(fmt.Sprintf("%v yara rules files don't compile and have been left out, run --yara-check for details", len(badRules)))
 	}
 
+	applyLocalOverrides(yaraGrep.Rules)
+
 	logger.Info(fmt.Sprintf("%v yara rules loaded", len(yaraGrep.GetRules())))
 	return yaraGrep, nil
 }
 
-func buildRules(blacklistedStatements ...string) (*YaraGrep, error) {
+// RulesVersion changes every time the compiled rules are rebuilt, or the list of disabled rules changes
+func RulesVersion() string {
+	info, err := os.Stat(pathToCompiledRules)
+
+	if err != nil {
+		return ""
+	}
+
+	disabled := appliedDisabledRules
+
+	if disabled == "" { // The rules are not loaded
+		disabled = disabledRulesDigest()
+	}
+
+	return fmt.Sprintf("%v-%v-%s", info.Size(), info.ModTime().UnixNano(), disabled)
+}
+
+// CheckRules compiles every rules file and returns the broken ones, the compiled rules are left untouched
+func CheckRules() ([]BadRule, error) {
+	yaraGrep, badRules, err := buildRules()
+
+	if err != nil {
+		return badRules, err
+	}
+
+	// The list of broken rules goes with the compiled rules, it's only saved when they are
+	yaraGrep.Destroy()
+	return badRules, nil
+}
+
+// buildRules compiles every rules file on its own first, so that a broken one is left out without compromising the
+// others (a compiler can't be used anymore once it failed)
+func buildRules() (*YaraGrep, []BadRule, error) {
+	var (
+		badRules      []BadRule
+		validatedOnes []includeStatement
+	)
+
+	for _, statement := range includeStatements() {
+		if err := validateStatement(statement); err != nil {
+			logger.Warning(fmt.Sprintf("Failed to load the rules of %v : %v", statement.file, err.Error()))
+			badRules = append(badRules, BadRule{Namespace: statement.namespace, File: statement.file, Error: err.Error()})
+			continue
+		}
+
+		validatedOnes = append(validatedOnes, statement)
+	}
+
+	if len(validatedOnes) == 0 {
+		return nil, badRules, errors.New("none of the YARA rules files compiles")
+	}
+
+	// Files that compile on their own may still conflict with each other, such as two rules with the same name in the
+	// same namespace. Each conflict costs a new compilation, there is rarely more than one
+	for {
+		compiler, err := yara.NewCompiler()
+		if err != nil {
+			logger.Error("Failed to initialize YARA compiler : " + err.Error())
+			return nil, badRules, err
+		}
+
+		failed := -1
+
+		for i, statement := range validatedOnes {
+			if err = compiler.AddString(statement.include(), statement.namespace); err != nil {
+				err = compilerError(compiler, err)
+				logger.Warning(fmt.Sprintf("Failed to load the rules of %v : %v", statement.file, err.Error()))
+				badRules = append(badRules, BadRule{Namespace: statement.namespace, File: statement.file, Error: err.Error()})
+				failed = i
+				break
+			}
+		}
+
+		if failed == -1 {
+			var rules *yara.Rules
+			rules, err = compiler.GetRules()
+			compiler.Destroy()
+
+			if err != nil {
+				return nil, badRules, err
+			}
 
+			// We convert the Rules struct to our YaraGrep in order to be able to call custom methods on it
+			return &YaraGrep{rules}, badRules, nil
+		}
+
+		compiler.Destroy()
+		validatedOnes = append(validatedOnes[:failed], validatedOnes[failed+1:]...)
+
+		if len(validatedOnes) == 0 {
+			return nil, badRules, errors.New("none of the YARA rules files compiles")
+		}
+	}
+}
+
+// validateStatement compiles a rules file with a compiler of its own
+func validateStatement(statement includeStatement) error {
 	compiler, err := yara.NewCompiler()
 	if err != nil {
-		logger.Error("Failed to initialize YARA compiler : " + err.Error())
-		return nil, err
+		return err
 	}
 
 	defer compiler.Destroy()
 
+	if err = compiler.AddString(statement.include(), statement.namespace); err != nil {
+		return compilerError(compiler, err)
+	}
+
+	return nil
+}
+
+// The error returned by the compiler only gives the number of errors, the messages are kept by the compiler
+func compilerError(compiler *yara.Compiler, err error) error {
+	if len(compiler.Errors) == 0 {
+		return err
+	}
+
+	var messages []string
+
+	for _, message := range compiler.Errors {
+		messages = append(messages, fmt.Sprintf("%s:%d: %s", message.Filename, message.Line, message.Text))
+	}
+
+	return errors.New(strings.Join(messages, "; "))
+}
+
+type includeStatement struct {
+	namespace string
+	file      string
+}
+
+func (statement includeStatement) include() string {
+	return fmt.Sprintf("include \"%s\"", statement.file)
+}
+
+// includeStatements lists the upstream rules files, followed by the local ones
+func includeStatements() []includeStatement {
+	var statements []includeStatement
+
 	for namespace, filename := range namespaces {
-		stringRules := parseIncludeFile(yaraPath + filename)
+		for _, file := range parseIncludeFile(yaraPath + filename) {
+			statements = append(statements, includeStatement{namespace: namespace, file: file})
+		}
+	}
 
-		for _, includeStatment := range stringRules {
+	for _, filename := range localRuleFiles() {
+		statements = append(statements, includeStatement{namespace: localNamespace(filename), file: filename})
+	}
 
-			statementIsBlacklisted := false
+	return statements
+}
 
-			for _, blacklistedStatement := range blacklistedStatements {
-				if includeStatment == blacklistedStatement {
-					statementIsBlacklisted = true
-					break
-				}
-			}
+// BadRule is a rules file left out of the compiled rules because it doesn't compile
+type BadRule struct {
+	Namespace string
+	File      string
+	Error     string
+}
 
-			if statementIsBlacklisted {
-				logger.Debug("Skipping blacklisted statement : " + includeStatment)
-				continue
-			}
+func (badRule BadRule) String() string {
+	return fmt.Sprintf("[%s] %s : %s", badRule.Namespace, badRule.File, badRule.Error)
+}
 
-			if err := compiler.AddString(includeStatment, namespace); err != nil {
-				logger.Warning(fmt.Sprintf("Failed to load a rule in %v : %v", includeStatment, err.Error()))
-				logger.Info("Recreating a new compiler ignoring that statement...")
-				return buildRules(append(blacklistedStatements, includeStatment)...)
-			}
+// LoadBadRules returns the rules files left out by the last build
+func LoadBadRules() ([]BadRule, error) {
+	content, err := ioutil.ReadFile(pathToBadRules)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var badRules []BadRule
+	err = json.Unmarshal(content, &badRules)
+	return badRules, err
+}
+
+func saveBadRules(badRules []BadRule) error {
+	if len(badRules) == 0 {
+		if err := os.Remove(pathToBadRules); err != nil && !os.IsNotExist(err) {
+			return err
 		}
+
+		return nil
 	}
 
-	var rules *yara.Rules
-	rules, err = compiler.GetRules()
+	content, err := json.MarshalIndent(badRules, "", "  ")
+
+	if err != nil {
+		return err
+	}
 
-	// We convert the Rules struct to our YaraGrep in order to be able to call custom methods on it
-	return &YaraGrep{rules}, err
+	return ioutil.WriteFile(pathToBadRules, content, 0644)
 }
 
 func hashFileMD5(filePath string) (string, error) {
@@ -187,76 +362,37 @@ func createIDFile(pathToIdFile string, md5 string) error {
 	return nil
 }
 
-// TODO : use repo's HEAD instead ?
-func haveYaraBeenUpdated() (bool, error) {
-
-	var (
-		res                  bool
-		storedIndexMD5String string
-		deferr               error
-	)
+// rulesID changes whenever the index of the upstream rules or a local rules file changes
+func rulesID() string {
+	indexMD5, _ := hashFileMD5(pathToRulesIndex)
 
-	currentIndexMD5String, _ := hashFileMD5(pathToRulesIndex)
-
-	if _, err := os.Stat(idFile); err == nil {
-		logger.Debug("Checking if rules have been updated. ")
-
-		file, err := os.Open(idFile)
-		if err != nil {
-			logger.Error("Can't open the ID file : " + err.Error())
-
-			return false, err // todo : is there a cleaner way to do it ?
-		}
-
-		defer func() {
-			if err := file.Close(); err != nil {
-				deferr = err
-			}
-		}()
-		if deferr != nil {
-			return false, deferr
-		}
-
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			storedIndexMD5String += scanner.Text()
-		}
-
-		if err := scanner.Err(); err != nil {
-			logger.Error("Error occurred when reading the ID file : " + err.Error())
-
-			return false, err
-		}
-
-		if currentIndexMD5String == storedIndexMD5String {
-			logger.Info("YARA rules have not been updated. ")
-			res = false
-		} else {
-			logger.Info("YARA rules have been updated. ")
-			err = createIDFile(idFile, currentIndexMD5String)
-			if err != nil {
-				return false, deferr
-			}
+	// The local rules are not listed in the index
+	return indexMD5 + "-" + localRulesDigest() + "-" + disabledRulesDigest()
+}
 
-			res = true
-		}
+// TODO : use repo's HEAD instead ?
+func haveYaraBeenUpdated(currentID string) bool {
+	storedID, err := ioutil.ReadFile(idFile)
 
-	} else {
-		logger.Info("Can't find the ID file : creating it.")
+	if err != nil {
+		logger.Info("Can't find the ID file : the rules will be compiled.")
+		return true
+	}
 
-		err = createIDFile(idFile, currentIndexMD5String)
-		if err != nil {
-			return false, deferr
-		}
+	logger.Debug("Checking if rules have been updated. ")
 
-		res = true
+	if strings.TrimSpace(string(storedID)) == currentID {
+		logger.Info("YARA rules have not been updated. ")
+		return false
 	}
 
-	return res, nil
+	logger.Info("YARA rules have been updated. ")
+	return true
 }
 
+// parseIncludeFile returns the files included by an index
 func parseIncludeFile(path string) []string {
-	var includeStatements []string
+	var includedFiles []string
 
 	file, err := os.Open(path)
 	if err != nil {
@@ -267,16 +403,14 @@ func parseIncludeFile(path string) []string {
 	defer file.Close() // No need to handle error, file in read only
 	scanner := bufio.NewScanner(file)
 
-	var validLine = regexp.MustCompile(`^include ".*"`)
+	var validLine = regexp.MustCompile(`^include "(.*)"`)
 	yaraIncludePatcher := strings.NewReplacer("./", yaraPath)
 
 	for scanner.Scan() {
-		line := scanner.Text()
-		if validLine.MatchString(line) {
-			line = yaraIncludePatcher.Replace(line)
-			includeStatements = append(includeStatements, line)
+		if match := validLine.FindStringSubmatch(scanner.Text()); match != nil {
+			includedFiles = append(includedFiles, yaraIncludePatcher.Replace(match[1]))
 		}
 	}
 
-	return includeStatements
+	return includedFiles
 }
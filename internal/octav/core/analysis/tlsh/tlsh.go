@@ -0,0 +1,237 @@
+package tlsh
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Port of the 128 buckets, 1 byte checksum flavour of TLSH, see https://github.com/trendmicro/tlsh
+const (
+	windowSize    = 5
+	buckets       = 128
+	codeSize      = buckets / 4
+	MinDataLength = 50
+	version       = "T1"
+	hashLength    = 2 * (3 + codeSize) // Checksum, length and quartile ratios, then the body
+)
+
+// Pearson hashing permutation
+var vTable = [256]byte{
+	1, 87, 49, 12, 176, 178, 102, 166, 121, 193, 6, 84, 249, 230, 44, 163,
+	14, 197, 213, 181, 161, 85, 218, 80, 64, 239, 24, 226, 236, 142, 38, 200,
+	110, 177, 104, 103, 141, 253, 255, 50, 77, 101, 81, 18, 45, 96, 31, 222,
+	25, 107, 190, 70, 86, 237, 240, 34, 72, 242, 20, 214, 244, 227, 149, 235,
+	97, 234, 57, 22, 60, 250, 82, 175, 208, 5, 127, 199, 111, 62, 135, 248,
+	174, 169, 211, 58, 66, 154, 106, 195, 245, 171, 17, 187, 182, 179, 0, 243,
+	132, 56, 148, 75, 128, 133, 158, 100, 130, 126, 91, 13, 153, 246, 216, 219,
+	119, 68, 223, 78, 83, 88, 201, 99, 122, 11, 92, 32, 136, 114, 52, 10,
+	138, 30, 48, 183, 156, 35, 61, 26, 143, 74, 251, 94, 129, 162, 63, 152,
+	170, 7, 115, 167, 241, 206, 3, 150, 55, 59, 151, 220, 90, 53, 23, 131,
+	125, 173, 15, 238, 79, 95, 89, 16, 105, 137, 225, 224, 217, 160, 37, 123,
+	118, 73, 2, 157, 46, 116, 9, 145, 134, 228, 207, 212, 202, 215, 69, 229,
+	27, 188, 67, 124, 168, 252, 42, 4, 29, 108, 21, 247, 19, 205, 39, 203,
+	233, 40, 186, 147, 198, 192, 155, 33, 164, 191, 98, 204, 165, 180, 117, 76,
+	140, 36, 210, 172, 41, 54, 159, 8, 185, 232, 113, 196, 231, 47, 146, 120,
+	51, 65, 28, 144, 254, 221, 93, 189, 194, 139, 112, 43, 71, 109, 184, 209,
+}
+
+func pearson(salt byte, i byte, j byte, k byte) byte {
+	return vTable[vTable[vTable[vTable[salt]^i]^j]^k]
+}
+
+// Digest is a decoded TLSH hash
+type Digest struct {
+	Checksum byte
+	Length   byte // Logarithm of the data length
+	Q1Ratio  byte
+	Q2Ratio  byte
+	Code     [codeSize]byte
+}
+
+// Hash returns the TLSH hash of data, data without enough variety such as a run of zeros can't be hashed
+func Hash(data []byte) (string, error) {
+	if len(data) < MinDataLength {
+		return "", errors.New(fmt.Sprintf("TLSH needs at least %v bytes", MinDataLength))
+	}
+
+	var (
+		bucketCounts [256]uint32
+		checksum     byte
+	)
+
+	// Trigrams of the sliding window are counted in buckets
+	for i := windowSize - 1; i < len(data); i++ {
+		c0, c1, c2, c3, c4 := data[i], data[i-1], data[i-2], data[i-3], data[i-4]
+
+		checksum = pearson(0, c0, c1, checksum)
+
+		bucketCounts[pearson(2, c0, c1, c2)]++
+		bucketCounts[pearson(3, c0, c1, c3)]++
+		bucketCounts[pearson(5, c0, c2, c3)]++
+		bucketCounts[pearson(7, c0, c2, c4)]++
+		bucketCounts[pearson(11, c0, c1, c4)]++
+		bucketCounts[pearson(13, c0, c3, c4)]++
+	}
+
+	sorted := make([]uint32, buckets)
+	copy(sorted, bucketCounts[:buckets])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	q1, q2, q3 := sorted[buckets/4-1], sorted[buckets/2-1], sorted[buckets*3/4-1]
+
+	nonZero := 0
+	for _, count := range bucketCounts[:buckets] {
+		if count > 0 {
+			nonZero++
+		}
+	}
+
+	if q3 == 0 || nonZero <= buckets/2 {
+		return "", errors.New("not enough variety in the data to compute a TLSH hash")
+	}
+
+	digest := Digest{
+		Checksum: checksum,
+		Length:   lengthCapturing(len(data)),
+		Q1Ratio:  byte((q1 * 100 / q3) % 16),
+		Q2Ratio:  byte((q2 * 100 / q3) % 16),
+	}
+
+	// Every bucket is encoded on 2 bits, depending on the quartile it falls in
+	for i := range digest.Code {
+		for j := 0; j < 4; j++ {
+			count := bucketCounts[4*i+j]
+
+			switch {
+			case count > q3:
+				digest.Code[i] |= 3 << (2 * j)
+			case count > q2:
+				digest.Code[i] |= 2 << (2 * j)
+			case count > q1:
+				digest.Code[i] |= 1 << (2 * j)
+			}
+		}
+	}
+
+	return digest.String(), nil
+}
+
+func lengthCapturing(length int) byte {
+	var capturing float64
+
+	switch {
+	case length <= 656:
+		capturing = math.Floor(math.Log(float64(length)) / math.Log(1.5))
+	case length <= 3199:
+		capturing = math.Floor(math.Log(float64(length))/math.Log(1.3) - 8.72777)
+	default:
+		capturing = math.Floor(math.Log(float64(length))/math.Log(1.1) - 62.5472)
+	}
+
+	return byte(int(capturing) & 0xff)
+}
+
+func swapNibbles(b byte) byte {
+	return b<<4 | b>>4
+}
+
+// String uses the same layout as the reference implementation, prefixed by its version
+func (digest Digest) String() string {
+	raw := make([]byte, 0, hashLength/2)
+	raw = append(raw, swapNibbles(digest.Checksum), swapNibbles(digest.Length), digest.Q2Ratio<<4|digest.Q1Ratio)
+
+	for i := codeSize - 1; i >= 0; i-- {
+		raw = append(raw, digest.Code[i])
+	}
+
+	return version + strings.ToUpper(hex.EncodeToString(raw))
+}
+
+// Parse reads a hash with or without its version prefix
+func Parse(hash string) (Digest, error) {
+	hash = strings.TrimPrefix(strings.ToUpper(hash), version)
+
+	if len(hash) != hashLength {
+		return Digest{}, errors.New(fmt.Sprintf("invalid TLSH hash '%s'", hash))
+	}
+
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return Digest{}, errors.New(fmt.Sprintf("invalid TLSH hash '%s'", hash))
+	}
+
+	digest := Digest{
+		Checksum: swapNibbles(raw[0]),
+		Length:   swapNibbles(raw[1]),
+		Q1Ratio:  raw[2] & 0xf,
+		Q2Ratio:  raw[2] >> 4,
+	}
+
+	for i := range digest.Code {
+		digest.Code[i] = raw[len(raw)-1-i]
+	}
+
+	return digest, nil
+}
+
+// Distance is 0 for identical files, it grows with the differences and has no upper bound
+func Distance(digest1 Digest, digest2 Digest) int {
+	distance := 0
+
+	if lengthDistance := modularDistance(int(digest1.Length), int(digest2.Length), 256); lengthDistance <= 1 {
+		distance += lengthDistance
+	} else {
+		distance += lengthDistance * 12
+	}
+
+	for _, ratios := range [][2]byte{{digest1.Q1Ratio, digest2.Q1Ratio}, {digest1.Q2Ratio, digest2.Q2Ratio}} {
+		if ratioDistance := modularDistance(int(ratios[0]), int(ratios[1]), 16); ratioDistance <= 1 {
+			distance += ratioDistance
+		} else {
+			distance += (ratioDistance - 1) * 12
+		}
+	}
+
+	if digest1.Checksum != digest2.Checksum {
+		distance++
+	}
+
+	// Buckets one quartile apart cost 1, opposite quartiles cost 6
+	for i := range digest1.Code {
+		for j := 0; j < 4; j++ {
+			quartile1 := int(digest1.Code[i]>>(2*j)) & 3
+			quartile2 := int(digest2.Code[i]>>(2*j)) & 3
+
+			switch bucketDistance := abs(quartile1 - quartile2); bucketDistance {
+			case 3:
+				distance += 6
+			default:
+				distance += bucketDistance
+			}
+		}
+	}
+
+	return distance
+}
+
+func modularDistance(x int, y int, modulo int) int {
+	direct := abs(x - y)
+
+	if wrapped := modulo - direct; wrapped < direct {
+		return wrapped
+	}
+
+	return direct
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
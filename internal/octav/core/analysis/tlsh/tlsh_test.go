@@ -0,0 +1,139 @@
+package tlsh
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The expected hashes and distances come from the reference implementation (tlsh_impl.cpp, 128 buckets and 1 byte
+// checksum), fed in uneven chunks. The inputs are generated so that the vectors don't need any file: xorshift32
+// pseudo-random bytes, some of them flipped to get close hashes
+var hashVectors = []struct {
+	data []byte
+	hash string
+}{
+	{xorshift(2463534242, 50), "T17890204587174B52231864654709125314AD199A44C2B230544C5395B792AA79422211"},
+	{xorshift(1, 50), "T12E9020542D19D15591055D62710D5E85541491017129790A11C619032831817D82825C"},
+	// Around the boundaries of the length capturing
+	{xorshift(2463534242, 656), "T1F1F03808403B2EA9E224E8BE84109302098304A99179255A25A93AF8F82EE3FE40B215"},
+	{xorshift(2463534242, 657), "T111013808403B2EA9E224E8BE84109302098304A99179255A25A93AF8F82EE3FE40B215"},
+	{xorshift(2463534242, 3199), "T1F261F60FC23B59F8E359EC7BE8107DDACD43150090A1591519FA29ECA097D3AF1A4966"},
+	{xorshift(2463534242, 3200), "T11D61F70FC23B59F8E359EC7BE8107CDACD43150090A0591519FA28ECA097D3AF1A4966"},
+	{xorshift(3007713514, 4096), "T1EC81F8BCD4A2159FB41827448B439EC65D84842E719CE10550543BA75CF05C6EFDA339"},
+	{xorshift(2463534242, 60000), "T14B431073A31745D8F8073E83B42FA86E69B6379317C712A4172A6D682C4A6FC9532188"},
+	{xorshift(2463534242, 65535), "T17D532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4"},
+	{xorshift(2463534242, 65536), "T1E8532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4"},
+	{xorshift(1274621926, 65536), "T18F53204FC4017E3E8864E9E5C441C42780662F1B18DBF25A2B94A8E043FF6F17406D6F"},
+	{flip(xorshift(2463534242, 65536), 10), "T15E532073E31B55E8F8473D83B42F659DAAF776A317C315A8031A79682C4AAFC95320C4"},
+	{flip(xorshift(2463534242, 65536), 100), "T152532073E31755E8F8473D83B42F655DAAB776A30B8315A8031A79683C4AAFC95320C4"},
+	{flip(xorshift(2463534242, 65536), 1000), "T13F532073F30B99D4E8533E93B82FA56D96B366B307C712A8171E7D682C4A9FC9131085"},
+	{flip(xorshift(3007713514, 4096), 5), "T12181F8BCD4A2155FB4182B8087439EC65D94841E719CE10560543BAB5CF05C6EFCA339"},
+	{flip(xorshift(3007713514, 4096), 50), "T1FA81E8FCC8A265AFF4243B808B439EC35E94842A718CE20664543BA75CF05C1EBCA339"},
+}
+
+var distanceVectors = []struct {
+	hash1    string
+	hash2    string
+	distance int
+}{
+	// 65536 random bytes, against the same with 10, 100 and 1000 bytes flipped, one byte less, 60000 bytes of it and
+	// other random bytes
+	{"T1E8532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4", "T15E532073E31B55E8F8473D83B42F659DAAF776A317C315A8031A79682C4AAFC95320C4", 7},
+	{"T1E8532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4", "T152532073E31755E8F8473D83B42F655DAAB776A30B8315A8031A79683C4AAFC95320C4", 10},
+	{"T1E8532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4", "T13F532073F30B99D4E8533E93B82FA56D96B366B307C712A8171E7D682C4A9FC9131085", 35},
+	{"T1E8532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4", "T17D532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4", 1},
+	{"T1E8532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4", "T14B431073A31745D8F8073E83B42FA86E69B6379317C712A4172A6D682C4A6FC9532188", 33},
+	{"T1E8532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4", "T18F53204FC4017E3E8864E9E5C441C42780662F1B18DBF25A2B94A8E043FF6F17406D6F", 226},
+	// 4096 random bytes, against the same with 5 and 50 bytes flipped
+	{"T1EC81F8BCD4A2159FB41827448B439EC65D84842E719CE10550543BA75CF05C6EFDA339", "T12181F8BCD4A2155FB4182B8087439EC65D94841E719CE10560543BAB5CF05C6EFCA339", 11},
+	{"T1EC81F8BCD4A2159FB41827448B439EC65D84842E719CE10550543BA75CF05C6EFDA339", "T1FA81E8FCC8A265AFF4243B808B439EC35E94842A718CE20664543BA75CF05C1EBCA339", 29},
+	// Around the boundaries of the length capturing, the length difference weighs more than one step apart
+	{"T17890204587174B52231864654709125314AD199A44C2B230544C5395B792AA79422211", "T1F1F03808403B2EA9E224E8BE84109302098304A99179255A25A93AF8F82EE3FE40B215", 311},
+	{"T17890204587174B52231864654709125314AD199A44C2B230544C5395B792AA79422211", "T111013808403B2EA9E224E8BE84109302098304A99179255A25A93AF8F82EE3FE40B215", 323},
+	{"T17890204587174B52231864654709125314AD199A44C2B230544C5395B792AA79422211", "T1F261F60FC23B59F8E359EC7BE8107DDACD43150090A1591519FA29ECA097D3AF1A4966", 414},
+	{"T17890204587174B52231864654709125314AD199A44C2B230544C5395B792AA79422211", "T11D61F70FC23B59F8E359EC7BE8107CDACD43150090A0591519FA28ECA097D3AF1A4966", 432},
+	{"T17890204587174B52231864654709125314AD199A44C2B230544C5395B792AA79422211", "T1E8532073E31755D9F8473E83B42F659DAAF776A307C315A4031A79682C4AAFC95320C4", 719},
+}
+
+func xorshift(seed uint32, length int) []byte {
+	data := make([]byte, length)
+
+	for i := range data {
+		seed ^= seed << 13
+		seed ^= seed >> 17
+		seed ^= seed << 5
+		data[i] = byte(seed >> 24)
+	}
+
+	return data
+}
+
+func flip(data []byte, count int) []byte {
+	for i := 0; i < count; i++ {
+		data[i*7919%len(data)] ^= 0x5a
+	}
+
+	return data
+}
+
+func TestHash(t *testing.T) {
+	for _, vector := range hashVectors {
+		hash, err := Hash(vector.data)
+
+		if err != nil {
+			t.Errorf("Hash of %v bytes : %s", len(vector.data), err.Error())
+		} else if hash != vector.hash {
+			t.Errorf("Hash of %v bytes : got %s, expected %s", len(vector.data), hash, vector.hash)
+		}
+	}
+}
+
+func TestHashRejected(t *testing.T) {
+	for _, data := range [][]byte{xorshift(2463534242, MinDataLength-1), bytes.Repeat([]byte{0}, 4096), bytes.Repeat([]byte("OctAV "), 1000)} {
+		if hash, err := Hash(data); err == nil {
+			t.Errorf("Hash of %v bytes : got %s, expected an error", len(data), hash)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	for _, vector := range distanceVectors {
+		digest1, err := Parse(vector.hash1)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		digest2, err := Parse(vector.hash2)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if distance := Distance(digest1, digest2); distance != vector.distance {
+			t.Errorf("Distance between %s and %s : got %v, expected %v", vector.hash1, vector.hash2, distance, vector.distance)
+		}
+
+		if distance := Distance(digest2, digest1); distance != vector.distance {
+			t.Errorf("Distance between %s and %s : got %v, expected %v", vector.hash2, vector.hash1, distance, vector.distance)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, vector := range hashVectors {
+		digest, err := Parse(vector.hash)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if digest.String() != vector.hash {
+			t.Errorf("%s parsed and printed back as %s", vector.hash, digest.String())
+		}
+
+		if distance := Distance(digest, digest); distance != 0 {
+			t.Errorf("%s is %v away from itself", vector.hash, distance)
+		}
+	}
+}
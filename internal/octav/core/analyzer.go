@@ -5,9 +5,21 @@ import (
 	"fmt"
 	"github.com/OctAVProject/OctAV/internal/octav/core/analysis"
 	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/dynamic"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/integrity"
 	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/static"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/static/elf"
+	"github.com/OctAVProject/OctAV/internal/octav/core/cache"
+	"github.com/OctAVProject/OctAV/internal/octav/core/history"
+	"github.com/OctAVProject/OctAV/internal/octav/core/quarantine"
+	"github.com/OctAVProject/OctAV/internal/octav/core/scoring"
+	"github.com/OctAVProject/OctAV/internal/octav/core/unpack"
 	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"github.com/hillu/go-yara"
+	"os"
+	"runtime"
+	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,257 +34,683 @@ type Analysis struct {
 	IsRunning         bool
 	Progress          float64
 	Logs              []LogEntry
+	Results           []*Result
+	Skipped           int // Files that are not supported, such as non ELF files
+	Cached            int // Files that haven't changed since they were found clean
+	Trusted           int // Files that haven't changed since their package installed them
+	Jobs              int // Number of files analysed at the same time, DefaultJobs if not set
+
+	// Known before the analysis of a file, such as the way it's started at boot. The files having some are analysed
+	// again even if they haven't changed, and they get a verdict even if they are not supported
+	Findings map[string][]scoring.Finding
+
+	// The files owned by a package are checked against it, the modified ones get a finding. With TrustPackages, the
+	// unmodified ones are not analysed
+	Packages      *integrity.Database
+	TrustPackages bool
+
+	filesProgress float64 // Sum of the progress of every file, each one counts for 1
+	mutex         sync.Mutex
 }
 
-var DetectedMalwares []*analysis.Executable
+type Detection struct {
+	*analysis.Executable
+	Reason   string
+	Findings []scoring.Finding
+}
+
+// libyara can't run more scans than that at the same time
+const maxJobs = 32
+
+var DefaultJobs = runtime.NumCPU()
+
+var DetectedMalwares []*Detection
+var detectedMalwaresMutex sync.Mutex
 
 func (currentAnalysis *Analysis) AddInfo(msg string) {
+	currentAnalysis.mutex.Lock()
+	defer currentAnalysis.mutex.Unlock()
+
 	currentAnalysis.Logs = append(currentAnalysis.Logs, LogEntry{Content: msg, IsError: false})
 }
 
 func (currentAnalysis *Analysis) AddError(msg string) {
+	currentAnalysis.mutex.Lock()
+	defer currentAnalysis.mutex.Unlock()
+
 	currentAnalysis.Logs = append(currentAnalysis.Logs, LogEntry{Content: msg, IsError: true})
 }
 
-func (currentAnalysis *Analysis) Start() error {
+// GetLogs returns a copy of the logs, safe to use while the analysis is running
+func (currentAnalysis *Analysis) GetLogs() []LogEntry {
+	currentAnalysis.mutex.Lock()
+	defer currentAnalysis.mutex.Unlock()
 
-	var (
-		staticThreatScore  uint
-		dynamicThreatScore uint
-		exe                *analysis.Executable
-		start              time.Time
-		elapsed            time.Duration
-		err                error
-	)
+	return append([]LogEntry{}, currentAnalysis.Logs...)
+}
 
-	currentAnalysis.IsRunning = true
-	maxProgressPerFile := 100. / float64(len(currentAnalysis.Files))
+func (currentAnalysis *Analysis) GetProgress() float64 {
+	currentAnalysis.mutex.Lock()
+	defer currentAnalysis.mutex.Unlock()
 
-	for _, filepath := range currentAnalysis.Files {
-		fileProgress := 0.
-		currentAnalysis.Progress += fileProgress * maxProgressPerFile / 100.
+	return currentAnalysis.Progress
+}
 
-		logger.Info("Analysing " + filepath)
-		currentAnalysis.AddInfo("Analysing " + filepath)
-		exe, err = analysis.LoadExecutable(filepath)
+func (currentAnalysis *Analysis) Running() bool {
+	currentAnalysis.mutex.Lock()
+	defer currentAnalysis.mutex.Unlock()
 
-		if err != nil {
-			logger.Error(err.Error())
-			currentAnalysis.AddError(err.Error())
-			goto NextFile
-		}
+	return currentAnalysis.IsRunning
+}
 
-		fileProgress = 5.                                          // 5% of the file analysis is done
-		currentAnalysis.Progress += 5. * maxProgressPerFile / 100. // +5%
+func (currentAnalysis *Analysis) GetSkipped() int {
+	currentAnalysis.mutex.Lock()
+	defer currentAnalysis.mutex.Unlock()
 
-		logger.Debug(exe.String())
+	return currentAnalysis.Skipped
+}
 
-		start = time.Now()
-		staticThreatScore, err = staticAnalysis(exe)
+// GetFiles returns a copy of the files found so far, safe to use while the analysis is running
+func (currentAnalysis *Analysis) GetFiles() []string {
+	currentAnalysis.mutex.Lock()
+	defer currentAnalysis.mutex.Unlock()
 
-		if err != nil {
-			errStr := "Not able to perform static analysis : " + err.Error()
-			logger.Error(errStr)
-			currentAnalysis.AddError(errStr)
-			goto NextFile
+	return append([]string{}, currentAnalysis.Files...)
+}
+
+// GetResults returns the results of the files analysed so far, safe to use while the analysis is running
+func (currentAnalysis *Analysis) GetResults() []*Result {
+	currentAnalysis.mutex.Lock()
+	defer currentAnalysis.mutex.Unlock()
+
+	var results []*Result
+
+	for _, result := range currentAnalysis.Results {
+		if result != nil {
+			results = append(results, result)
 		}
+	}
+
+	return results
+}
 
-		fileProgress = 25.                                          // 25% of the file analysis is done
-		currentAnalysis.Progress += 20. * maxProgressPerFile / 100. // +20%
+// Moves the progress of a file forward, between 0 and 1. The members of archives don't count
+func (currentAnalysis *Analysis) advance(result *Result, fileProgress float64) {
+	if result.depth > 0 {
+		return
+	}
 
-		elapsed = time.Now().Sub(start)
-		logger.Info(fmt.Sprintf("Static Analysis done in %v", elapsed))
+	currentAnalysis.addProgress(fileProgress - result.progress)
+	result.progress = fileProgress
+}
 
-		logger.Info(fmt.Sprintf("Static score: %v", staticThreatScore))
+// fileProgress is the part of a single file analysis that has just been done, between 0 and 1
+func (currentAnalysis *Analysis) addProgress(fileProgress float64) {
+	currentAnalysis.mutex.Lock()
+	defer currentAnalysis.mutex.Unlock()
 
-		if staticThreatScore >= 100 {
-			currentAnalysis.AddError("Malware detected : " + filepath)
-			malwareDetected(exe)
-			goto NextFile
-		}
+	currentAnalysis.filesProgress += fileProgress
+	currentAnalysis.Progress = 100. * currentAnalysis.filesProgress / float64(len(currentAnalysis.Files))
+}
 
-		start = time.Now()
-		dynamicThreatScore, err = dynamicAnalysis(exe)
+// Start analyses the files using a pool of workers, results are stored in the same order as the files
+func (currentAnalysis *Analysis) Start() error {
+	files := currentAnalysis.Files
+	paths := make(chan string)
 
-		if err != nil {
-			errStr := "Not able to perform dynamic analysis : " + err.Error()
-			logger.Error(errStr)
-			currentAnalysis.AddError(errStr)
-			goto NextFile
+	go func() {
+		for _, file := range files {
+			paths <- file
 		}
 
-		fileProgress = 99.                                          // 99% of the file analysis is done
-		currentAnalysis.Progress += 74. * maxProgressPerFile / 100. // +74%
+		close(paths)
+	}()
 
-		elapsed = time.Now().Sub(start)
-		logger.Info(fmt.Sprintf("Dynamic Analysis done in %v", elapsed))
+	return currentAnalysis.StartStream(paths)
+}
 
-		logger.Info(fmt.Sprintf("Dynamic score: %v", dynamicThreatScore))
+// StartStream analyses the files as they are received, until the channel is closed.
+// The files are analysed while the directories are still being walked, so the progress is relative to the files found so far.
+// Files and Results are filled in the order the files are received.
+func (currentAnalysis *Analysis) StartStream(paths <-chan string) error {
 
-		if dynamicThreatScore >= 100 {
-			currentAnalysis.AddError("Malware detected : " + filepath)
-			malwareDetected(exe)
-		} else if staticThreatScore+dynamicThreatScore >= 170 {
-			currentAnalysis.AddError("Malware detected : " + filepath)
-			malwareDetected(exe)
-		}
+	type job struct {
+		index    int
+		filepath string
+	}
+
+	jobs := currentAnalysis.Jobs
+
+	if jobs <= 0 {
+		jobs = DefaultJobs
+	}
+
+	if jobs > maxJobs {
+		jobs = maxJobs
+	}
+
+	currentAnalysis.mutex.Lock()
+	currentAnalysis.IsRunning = true
+	currentAnalysis.Files = nil
+	currentAnalysis.Results = nil
+	currentAnalysis.Skipped, currentAnalysis.Cached, currentAnalysis.Trusted = 0, 0, 0
+	currentAnalysis.Progress, currentAnalysis.filesProgress = 0, 0
+	currentAnalysis.mutex.Unlock()
+
+	acquireCache()
+	defer releaseCache()
+
+	queue := make(chan job)
+
+	var workers sync.WaitGroup
+
+	for i := 0; i < jobs; i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for next := range queue {
+				result := currentAnalysis.analyseFile(next.filepath)
+
+				currentAnalysis.mutex.Lock()
+				currentAnalysis.Results[next.index] = result
+				currentAnalysis.mutex.Unlock()
+			}
+		}()
+	}
 
-		elapsed = time.Now().Sub(start)
-		currentAnalysis.AddInfo(fmt.Sprintf("File analysis done in %v", elapsed))
+	for filepath := range paths {
+		currentAnalysis.mutex.Lock()
+		currentAnalysis.Files = append(currentAnalysis.Files, filepath)
+		currentAnalysis.Results = append(currentAnalysis.Results, nil)
+		index := len(currentAnalysis.Files) - 1
+		currentAnalysis.mutex.Unlock()
 
-	NextFile:
-		currentAnalysis.Progress += (100. - fileProgress) * maxProgressPerFile / 100. // Add the remaining to make 100%
+		queue <- job{index, filepath}
 	}
 
+	close(queue)
+	workers.Wait()
+
+	currentAnalysis.mutex.Lock()
 	currentAnalysis.IsRunning = false
+	currentAnalysis.Progress = 100
+	summary := fmt.Sprintf("%v files analysed, %v skipped, %v unchanged since their last analysis, %v unchanged since their installation",
+		len(currentAnalysis.Files)-currentAnalysis.Skipped-currentAnalysis.Cached-currentAnalysis.Trusted,
+		currentAnalysis.Skipped, currentAnalysis.Cached, currentAnalysis.Trusted)
+	currentAnalysis.mutex.Unlock()
+
+	logger.Info(summary)
+	currentAnalysis.AddInfo(summary)
+
 	return nil
 }
 
-func staticAnalysis(exe *analysis.Executable) (uint, error) {
-	logger.Header("static analysis")
+func (currentAnalysis *Analysis) analyseFile(filepath string) (result *Result) {
 
-	var score uint = 0
+	result = newResult(filepath)
 
-	hashIsKnown, err := static.IsHashKnownToBeMalicious(exe)
+	// A crafted file can make a parser panic, it mustn't take down the whole scan nor the daemon
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			errStr := fmt.Sprintf("The analysis of %s crashed : %v", filepath, recovered)
+			logger.Error(errStr + "\n" + string(debug.Stack()))
+			currentAnalysis.AddError(errStr)
+			result.addError(errStr)
+			result.FinishedAt = time.Now()
+			currentAnalysis.advance(result, 1.)
+		}
+	}()
 
-	if err != nil {
-		logger.Error(err.Error())
-		logger.Debug("Trying to fix the error by syncing the database.")
-		err = SyncDatabase()
+	findings := currentAnalysis.Findings[filepath]
 
-		if err != nil {
-			return 0, err
-		}
+	for _, finding := range findings {
+		logger.Warning(fmt.Sprintf("%s : %s", filepath, finding.Evidence))
+		result.scorecard.Add(finding.Stage, finding.RuleID, finding.Evidence, finding.Weight)
+	}
 
-		hashIsKnown, err = static.IsHashKnownToBeMalicious(exe)
+	currentAnalysis.mutex.Lock()
+	currentAnalysis.FileBeingAnalysed = filepath
+	currentAnalysis.mutex.Unlock()
 
-		if err != nil {
-			return 0, err
-		}
+	cacheKey, cacheable := fileCacheKey(filepath)
+
+	if entry := cachedEntry(cacheKey, cacheable && len(findings) == 0); entry != nil {
+		logger.Debug(fmt.Sprintf("Skipping %s : %s since %s", filepath, entry.Verdict, entry.CachedAt.Format(time.RFC3339)))
+		result.loadCache(entry)
+
+		currentAnalysis.mutex.Lock()
+		currentAnalysis.Cached++
+		currentAnalysis.mutex.Unlock()
+
+		currentAnalysis.addProgress(1.)
+		return result
 	}
 
-	if hashIsKnown {
-		return 100, nil
+	modified := false
+
+	if owner := currentAnalysis.Packages.Lookup(filepath); owner != nil {
+		result.Package = owner.String()
+		intact, err := owner.Intact(filepath)
+
+		switch {
+		case err != nil:
+			logger.Warning(fmt.Sprintf("Can't check %s against its package : %s", filepath, err.Error()))
+		case intact && currentAnalysis.TrustPackages && len(findings) == 0:
+			logger.Debug(fmt.Sprintf("Skipping %s : unchanged since installed by %s", filepath, owner))
+			result.trust()
+
+			currentAnalysis.mutex.Lock()
+			currentAnalysis.Trusted++
+			currentAnalysis.mutex.Unlock()
+
+			currentAnalysis.addProgress(1.)
+			return result
+		case !intact:
+			modified = true
+			evidence := fmt.Sprintf("Differs from the version installed by %s", owner)
+			logger.Danger(fmt.Sprintf("%s : %s", filepath, evidence))
+			result.scorecard.Add(scoring.StageStatic, "integrity.modified_file", evidence, policy.Integrity.ModifiedFile)
+		}
 	}
 
-	logger.Info("Looking for IPs and domains known to be malicious")
-	var maliciousIPorDomainFound bool
+	exe, err := analysis.LoadExecutable(filepath)
 
-	if maliciousIPorDomainFound, err = static.MaliciousDomainFound(exe.Content); err != nil {
-		return 0, err
-	} else if maliciousIPorDomainFound {
-		score += 70
-	} else {
+	if skipped, ok := err.(*analysis.SkippedError); ok {
+		logger.Debug("Skipping " + filepath + " : " + skipped.Reason)
+		result.skip(skipped.Reason)
 
-		if maliciousIPorDomainFound, err = static.MaliciousIPFound(exe.Content); err != nil {
-			return 0, err
-		} else if maliciousIPorDomainFound {
-			score += 70
+		if len(findings) > 0 || modified {
+			result.Verdict = scoring.Clean
+			result.evaluate()
 		}
+
+		currentAnalysis.mutex.Lock()
+		currentAnalysis.Skipped++
+		currentAnalysis.mutex.Unlock()
+
+		currentAnalysis.addProgress(1.)
+		return result
 	}
 
-	ssDeepDistance, err := static.GetHighestSSDeepDistance(exe)
+	logger.Info("Analysing " + filepath)
+	currentAnalysis.AddInfo("Analysing " + filepath)
+
+	start := time.Now()
 
 	if err != nil {
 		logger.Error(err.Error())
-		logger.Debug("Trying to fix the error by syncing the database.")
-		err = SyncDatabase()
+		currentAnalysis.AddError(err.Error())
+		result.addError(err.Error())
+	} else {
+		result.budget = unpack.NewBudget(unpack.DefaultLimits, int64(len(exe.Content)))
+		currentAnalysis.analyseExecutable(exe, result)
+	}
 
-		if err != nil {
-			return 0, err
+	currentAnalysis.AddInfo(fmt.Sprintf("File analysis done in %v", time.Now().Sub(start)))
+
+	// A modified file must be checked against its package again, whatever its verdict
+	if cacheable && !modified && result.Verdict == scoring.Clean {
+		saveToCache(cacheKey, result)
+	}
+
+	currentAnalysis.advance(result, 1.) // Add the remaining to make 100%
+	return result
+}
+
+// Analyses a file from disk or from an archive, its result is saved to the history
+func (currentAnalysis *Analysis) analyseExecutable(exe *analysis.Executable, result *Result) {
+
+	var breakdown scoring.Breakdown
+
+	result.setExecutable(exe)
+	currentAnalysis.advance(result, .05) // 5% of the file analysis is done
+
+	logger.Debug(exe.String())
+
+	start := time.Now()
+
+	if err := staticAnalysis(exe, result); err != nil {
+		errStr := "Not able to perform static analysis : " + err.Error()
+		logger.Error(errStr)
+		currentAnalysis.AddError(errStr)
+		result.addError(errStr)
+		goto Done
+	}
+
+	logger.Info(fmt.Sprintf("Static Analysis done in %v", time.Now().Sub(start)))
+
+	if exe.Handler.Checks.Has(analysis.CheckMembers) {
+		currentAnalysis.analyseMembers(exe, result)
+	}
+
+	currentAnalysis.advance(result, .25) // 25% of the file analysis is done
+
+	breakdown = result.evaluate()
+	logger.Info(fmt.Sprintf("Static score: %v", breakdown.StaticTotal))
+
+	if breakdown.Verdict == scoring.Malicious {
+		currentAnalysis.malwareDetected(exe, result)
+		goto Done
+	}
+
+	start = time.Now()
+
+	if err := dynamicAnalysis(exe, result); err != nil {
+		errStr := "Not able to perform dynamic analysis : " + err.Error()
+		logger.Error(errStr)
+		currentAnalysis.AddError(errStr)
+		result.addError(errStr)
+		goto Done
+	}
+
+	currentAnalysis.advance(result, .99) // 99% of the file analysis is done
+	logger.Info(fmt.Sprintf("Dynamic Analysis done in %v", time.Now().Sub(start)))
+
+	breakdown = result.evaluate()
+	logger.Info(fmt.Sprintf("Dynamic score: %v", breakdown.DynamicTotal))
+
+	if breakdown.Verdict == scoring.Malicious {
+		currentAnalysis.malwareDetected(exe, result)
+	} else if breakdown.Verdict == scoring.Suspicious {
+		logger.Warning(result.Filename + " is suspicious : " + breakdown.Summary())
+		currentAnalysis.AddInfo("Suspicious file : " + result.Filename)
+		currentAnalysis.addBreakdown(breakdown)
+	}
+
+Done:
+	result.FinishedAt = time.Now()
+	breakdown = result.evaluate()
+
+	if len(breakdown.Findings) > 0 {
+		logger.Info(breakdown.String())
+	}
+
+	saveToHistory(result.record())
+}
+
+// Every member goes through the whole analysis, the archive gets the weight of its worst member
+func (currentAnalysis *Analysis) analyseMembers(archive *analysis.Executable, result *Result) {
+
+	if !unpack.IsSupported(archive.Handler.Name) {
+		return
+	}
+
+	logger.Info("Unpacking " + result.Filename)
+
+	err := unpack.Unpack(archive.Filename, archive.Handler.Name, archive.Content, result.depth, result.budget, func(member unpack.Member) {
+		name := result.Filename + "!" + member.Name
+		exe, err := analysis.LoadMember(name, member.Content)
+
+		if _, skipped := err.(*analysis.SkippedError); skipped {
+			return
 		}
 
-		ssDeepDistance, err = static.GetHighestSSDeepDistance(exe)
+		memberResult := result.newMember(name)
 
 		if err != nil {
-			return 0, err
+			logger.Error(err.Error())
+			memberResult.addError(err.Error())
+		} else {
+			currentAnalysis.analyseExecutable(exe, memberResult)
+		}
+
+		result.Members = append(result.Members, memberResult)
+	})
+
+	if limitErr, exceeded := err.(*unpack.LimitError); exceeded {
+		logger.Warning(fmt.Sprintf("Stopped unpacking %s : %s", result.Filename, limitErr.Reason))
+		result.scorecard.Add(scoring.StageStatic, "archive.limit", "Stopped unpacking : "+limitErr.Reason, policy.Archives.LimitExceeded)
+	} else if err != nil {
+		logger.Warning(fmt.Sprintf("Can't unpack %s entirely : %s", result.Filename, err.Error()))
+	}
+
+	for _, member := range result.Members {
+		switch member.Verdict {
+		case scoring.Malicious:
+			result.scorecard.Add(scoring.StageStatic, "archive.member", member.Filename+" is malicious", policy.Archives.MaliciousMember)
+			return
+		case scoring.Suspicious:
+			result.scorecard.Add(scoring.StageStatic, "archive.member", member.Filename+" is suspicious", policy.Archives.SuspiciousMember)
+			return
+		}
+	}
+}
+
+// Lists the findings in the logs so the user knows why a file has been flagged
+func (currentAnalysis *Analysis) addBreakdown(breakdown scoring.Breakdown) {
+	for _, finding := range breakdown.Findings {
+		currentAnalysis.AddInfo(fmt.Sprintf("+%v %s : %s", finding.Weight, finding.RuleID, finding.Evidence))
+	}
+}
+
+func staticAnalysis(exe *analysis.Executable, result *Result) error {
+	logger.Header("static analysis")
+
+	scorecard := result.scorecard
+
+	checks := exe.Handler.Checks
+
+	if checks.Has(analysis.CheckHashes) {
+		logger.Info("Comparing hash signatures...")
+
+		if hashMatch, hashIsKnown := hashDatabase.Lookup(exe); hashIsKnown {
+			logger.Danger("Known malicious hash : " + hashMatch.String())
+			scorecard.Add(scoring.StageStatic, "hash.known", hashMatch.String(), policy.Hashes.Weight)
+
+			if scorecard.Breakdown().Verdict == scoring.Malicious { // No need to go further
+				return nil
+			}
 		}
 	}
 
-	if ssDeepDistance > 90 {
-		logger.Danger("SSDeep distance is higher than 90")
-		score += 80
+	if checks.Has(analysis.CheckStrings) {
+		stringsAnalysis(exe, result)
+	}
+
+	if checks.Has(analysis.CheckSSDeep) {
+		ssdeepAnalysis(exe, scorecard)
+	}
+
+	if checks.Has(analysis.CheckTLSH) {
+		tlshAnalysis(exe, scorecard)
+	}
+
+	if checks.Has(analysis.CheckImportHash) {
+		if name, found := importHashDatabase.Lookup(exe); found {
+			evidence := fmt.Sprintf("Import hash %s shared with '%s'", exe.ImportHash, name)
+			logger.Danger(evidence)
+			scorecard.Add(scoring.StageStatic, "imphash.known", evidence, policy.ImportHash.Weight)
+		}
+	}
+
+	if checks.Has(analysis.CheckStructure) {
+		structureAnalysis(exe, scorecard)
+	}
+
+	if !checks.Has(analysis.CheckYara) {
+		return nil
 	}
 
 	logger.Info("Looking for matching YARA rules")
 	matches, err := yaraGrep.GetAllMatchingRules(exe)
 
 	if err != nil {
-		return 0, err
+		return err
 	}
 
+	yaraAnalysis(matches, result)
+	return nil
+}
+
+// yaraAnalysis reports the matching rules and scores them, a rule can set its own weight through its meta
+func yaraAnalysis(matches yara.MatchRules, result *Result) {
+	scorecard := result.scorecard
+
 	if len(matches) <= 0 {
 		logger.Info("No YARA match.")
-	} else {
-		for _, match := range matches {
+		return
+	}
 
-			// Skip is__elf rule
-			if match.Rule == "is__elf" {
+	for _, match := range matches {
+		rulePolicy := policy.YaraRule(match.Namespace, match.Rule)
+
+		if rulePolicy != nil && rulePolicy.Ignore {
+			continue
+		}
+
+		logger.Info("[" + match.Namespace + "]" + " is matching with " + match.Rule)
+		result.YaraMatches = append(result.YaraMatches, newYaraMatch(match))
+
+		// The score or the severity given by the author of the rule takes precedence over the policy
+		weight, hasMetaWeight := policy.YaraMetaWeight(match.Meta)
+
+		if !hasMetaWeight {
+			if rulePolicy == nil {
+				logger.Warning(fmt.Sprintf("No policy for rule '%v' in namespace '%v' !", match.Rule, match.Namespace))
 				continue
 			}
 
-			logger.Info("[" + match.Namespace + "]" + " is matching with " + match.Rule)
-
-			switch match.Namespace {
-			case "malware":
-
-				// Add here rules that can't be considered as malware detection
-				if match.Rule == "with_sqlite" {
-					break
-				}
-
-				switch match.Rule {
-				case "suspicious_packer_section":
-					logger.Warning("Suspicious packed binary detected")
-					score += 50
-
-				case "ldpreload":
-					logger.Warning("LD_PRELOAD detected")
-					score += 20
-
-				default:
-					logger.Danger(fmt.Sprintf("Program matched YARA rule '%v' meaning it's a malware", match.Rule))
-					return 100, nil
-				}
-
-			case "packer":
-				if strings.HasPrefix(match.Rule, "UPX") {
-					logger.Warning("Suspicious packed binary detected")
-					score += 50
-				}
-
-			case "anti-debug/vm":
-				if match.Rule == "vmdetect_misc" {
-					logger.Warning("The binary tries to detect if it's running in a VM")
-					score += 60
-				} else if strings.HasPrefix(match.Rule, "network_") {
-					logger.Warning("The binary uses typical malware communications")
-					score += 20
-				} else {
-					score += 40
-				}
-
-			default:
-				logger.Warning(fmt.Sprintf("Namespace '%v' not supported yet !", match.Namespace))
-			}
+			weight = rulePolicy.Weight
+		}
+
+		if weight == 0 { // Rules that can't be considered as malware detection
+			continue
+		}
+
+		evidence := fmt.Sprintf("YARA rule '%v' from namespace '%v'", match.Rule, match.Namespace)
+
+		if description, isString := match.Meta["description"].(string); isString && description != "" {
+			evidence += " (" + description + ")"
+		}
+
+		if rulePolicy != nil && rulePolicy.Description != "" {
+			logger.Warning(rulePolicy.Description)
+			evidence = rulePolicy.Description + " : " + evidence
+		}
+
+		scorecard.Add(scoring.StageStatic, "yara."+match.Namespace+"."+match.Rule, evidence, weight)
+	}
+}
+
+// The IOCs are kept in the result for the triage, the domains and IPs are looked up in the blocklists
+func stringsAnalysis(exe *analysis.Executable, result *Result) {
+	logger.Info("Looking for IOCs in the strings")
+
+	iocs := static.ExtractIOCs(exe.Content)
+	scorecard := result.scorecard
+
+	if !iocs.Empty() {
+		result.IOCs = iocs
+	}
+
+	if domainMatches := domainDatabase.Find(iocs.Domains); len(domainMatches) > 0 {
+		var evidences []string
+
+		for _, domainMatch := range domainMatches {
+			logger.Danger("Malicious domain found : " + domainMatch.String())
+			evidences = append(evidences, domainMatch.String())
 		}
+
+		scorecard.Add(scoring.StageStatic, "ioc.domain", "Malicious domain found : "+strings.Join(evidences, ", "), policy.IOCs.Domain)
 	}
 
-	return score, nil
+	if ipMatches := ipDatabase.Find(iocs.IPs); len(ipMatches) > 0 {
+		var evidences []string
+
+		for _, ipMatch := range ipMatches {
+			logger.Danger("Malicious IP found : " + ipMatch.String())
+			evidences = append(evidences, ipMatch.String())
+		}
+
+		scorecard.Add(scoring.StageStatic, "ioc.ip", "Malicious IP found : "+strings.Join(evidences, ", "), policy.IOCs.IP)
+	}
 }
 
-func dynamicAnalysis(exe *analysis.Executable) (uint, error) {
+// Anomalies of the same kind only count once, their evidences are merged
+func structureAnalysis(exe *analysis.Executable, scorecard *scoring.Scorecard) {
+	logger.Info("Looking for anomalies in the ELF structure")
+
+	weights := map[string]uint{
+		elf.RWXSegment:         policy.ELF.RWXSegment,
+		elf.HighEntropy:        policy.ELF.HighEntropy,
+		elf.Stripped:           policy.ELF.Stripped,
+		elf.NoSectionHeaders:   policy.ELF.NoSectionHeaders,
+		elf.MalformedHeaders:   policy.ELF.MalformedHeaders,
+		elf.EntryOutsideCode:   policy.ELF.EntryOutsideCode,
+		elf.UnusualInterpreter: policy.ELF.UnusualInterpreter,
+		elf.AntiDebug:          policy.ELF.AntiDebug,
+		elf.ReverseShell:       policy.ELF.ReverseShell,
+	}
+
+	var kinds []string
+	evidences := make(map[string][]string)
+
+	for _, anomaly := range elf.Analyse(exe.Content, policy.ELF.MaxEntropy) {
+		logger.Debug(anomaly.Kind + " : " + anomaly.Evidence)
+
+		if _, seen := evidences[anomaly.Kind]; !seen {
+			kinds = append(kinds, anomaly.Kind)
+		}
+
+		evidences[anomaly.Kind] = append(evidences[anomaly.Kind], anomaly.Evidence)
+	}
+
+	for _, kind := range kinds {
+		if weights[kind] > 0 {
+			scorecard.Add(scoring.StageStatic, "elf."+kind, strings.Join(evidences[kind], ", "), weights[kind])
+		}
+	}
+}
+
+func ssdeepAnalysis(exe *analysis.Executable, scorecard *scoring.Scorecard) {
+	match, found := ssdeepDatabase.Closest(exe)
+
+	if !found {
+		return
+	}
+
+	logger.Debug(match.String())
+
+	if weight, inBand := policy.SSDeepWeight(match.Similarity); inBand && weight > 0 {
+		logger.Danger(fmt.Sprintf("SSDeep similarity of %v with the known malware '%s'", match.Similarity, match.Name))
+		scorecard.Add(scoring.StageStatic, "ssdeep.similarity", match.String(), weight)
+	}
+}
+
+func tlshAnalysis(exe *analysis.Executable, scorecard *scoring.Scorecard) {
+	match, found := tlshDatabase.Closest(exe)
+
+	if !found {
+		return
+	}
+
+	logger.Debug(match.String())
+
+	if weight, inBand := policy.TLSHWeight(match.Distance); inBand && weight > 0 {
+		logger.Danger(fmt.Sprintf("TLSH distance of %v with the known malware '%s'", match.Distance, match.Name))
+		scorecard.Add(scoring.StageStatic, "tlsh.similarity", match.String(), weight)
+	}
+}
+
+func dynamicAnalysis(exe *analysis.Executable, result *Result) error {
+
+	if !exe.Handler.Checks.Has(analysis.CheckDynamic) {
+		logger.Debug("No dynamic analysis for " + exe.Handler.Name + " files")
+		return nil
+	}
 
 	logger.Header("dynamic analysis")
 	logger.Info("Analysing binary in a sandboxed environment, this might take some time...")
 
 	jsonReport, err := dynamic.SendFileToSandBox(exe)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
 	if jsonReport["dynamic_analysis"] == nil {
-		return 0, errors.New("no behavior analysis in the report")
+		return errors.New("no behavior analysis in the report")
 	}
 
 	behavior := jsonReport["dynamic_analysis"].(map[string]interface{})
@@ -292,7 +730,7 @@ func dynamicAnalysis(exe *analysis.Executable) (uint, error) {
 		syscalls := behavior["syscalls"].([]interface{})
 
 		if len(syscalls) == 0 {
-			return 0, errors.New("no syscall were returned by the sandbox")
+			return errors.New("no syscall were returned by the sandbox")
 		}
 
 		for _, syscall := range syscalls {
@@ -311,55 +749,148 @@ func dynamicAnalysis(exe *analysis.Executable) (uint, error) {
 
 	prediction, err := dynamic.ApplyModel(syscallsIds)
 
-	predictionThreshold := 0.88
-
-	if prediction > predictionThreshold {
-		return 100, err
-	} else if err != nil {
-		return 0, err
+	if err != nil {
+		return err
 	}
 
-	return uint(prediction * 100 / predictionThreshold), nil
+	evidence := fmt.Sprintf("ML model prediction of %.2f on %v syscalls", prediction, len(syscallsIds))
+	result.scorecard.Add(scoring.StageDynamic, "ml.prediction", evidence, policy.MLWeight(prediction))
+	return nil
 }
 
-func malwareDetected(exe *analysis.Executable) {
-	/*
-		var (
-			err    error
-			choice string
-		)
-	*/
+func (currentAnalysis *Analysis) malwareDetected(exe *analysis.Executable, result *Result) {
+	currentAnalysis.AddError("Malware detected : " + exe.Filename)
+	currentAnalysis.addBreakdown(result.Score)
 
-	DetectedMalwares = append(DetectedMalwares, exe)
-	logger.Danger(exe.Filename + " classified as a malware")
+	// The member of an archive can't be quarantined on its own, the archive will be
+	if result.depth > 0 {
+		logger.Danger(exe.Filename + " classified as a malware : " + result.Score.Summary())
+		result.Action = history.ActionDetected
+		return
+	}
 
-	/*
-		if !DaemonMode {
-			reader := bufio.NewReader(os.Stdin)
+	result.Action = malwareDetected(exe, result.Score)
+}
 
-			for choice != "yes" && choice != "no" {
-				fmt.Print("Do you want to delete this file ? [yes/no] ")
-				choice, err = reader.ReadString('\n')
+// Returns the action that has been taken
+func malwareDetected(exe *analysis.Executable, breakdown scoring.Breakdown) string {
+	detection := &Detection{Executable: exe, Reason: breakdown.Summary(), Findings: breakdown.Findings}
 
-				if err != nil {
-					logger.Fatal(err.Error())
-				}
+	detectedMalwaresMutex.Lock()
+	DetectedMalwares = append(DetectedMalwares, detection)
+	detectedMalwaresMutex.Unlock()
 
-				choice = strings.ToLower(choice[:len(choice)-1])
-			}
+	logger.Danger(exe.Filename + " classified as a malware : " + detection.Reason)
 
-			if choice == "yes" {
-				logger.Info("Deleting malware...")
-			} else {
-				logger.Danger("Not deleting " + exe.Filename)
-			}
+	// In daemon mode, OctAV has root privileges and nobody is there to take a decision
+	if DaemonMode {
+		if err := QuarantineMalware(exe.Filename); err != nil {
+			logger.Error("Can't quarantine " + exe.Filename + " : " + err.Error())
 		} else {
+			return history.ActionQuarantined
+		}
+	}
 
-			if dialog.Message("%s", exe.Filename+" has been identified as a malware, do you want to delete it ?").Title("Malware detected !").YesNo() {
-				logger.Info("Deleting malware...")
-			} else {
-				logger.Danger("Not deleting " + exe.Filename)
-			}
+	return history.ActionDetected
+}
+
+// GetDetectedMalwares returns a copy of the detections, safe to use while analyses are running
+func GetDetectedMalwares() []Detection {
+	detectedMalwaresMutex.Lock()
+	defer detectedMalwaresMutex.Unlock()
+
+	var malwares []Detection
+
+	for _, malware := range DetectedMalwares {
+		malwares = append(malwares, *malware)
+	}
+
+	return malwares
+}
+
+// GetHistory returns the last analyses results, including the ones from previous runs
+func GetHistory(limit int) ([]history.Record, error) {
+	if historyStore == nil {
+		return nil, errors.New("the history is not available")
+	}
+
+	return historyStore.Last(limit)
+}
+
+func saveToHistory(record *history.Record) {
+	if historyStore == nil {
+		return
+	}
+
+	if err := historyStore.Add(record); err != nil {
+		logger.Error("Can't save the analysis to the history : " + err.Error())
+	}
+}
+
+// QuarantineMalware moves a detected malware into the quarantine vault, it can be restored later on
+func QuarantineMalware(filepath string) error {
+	detectedMalwaresMutex.Lock()
+	defer detectedMalwaresMutex.Unlock()
+
+	var remainingDetections []*Detection
+	var detection *Detection
+
+	for _, malware := range DetectedMalwares {
+		if malware.Filename == filepath && detection == nil {
+			detection = malware
+		} else {
+			remainingDetections = append(remainingDetections, malware)
 		}
-	*/
+	}
+
+	if detection == nil {
+		return errors.New(filepath + " hasn't been detected as a malware")
+	}
+
+	if _, err := quarantine.Add(detection.Executable, detection.Reason); err != nil {
+		return err
+	}
+
+	DetectedMalwares = remainingDetections
+	return nil
+}
+
+func fileCacheKey(filepath string) (cache.Key, bool) {
+	info, err := os.Stat(filepath)
+
+	if err != nil {
+		return cache.Key{}, false
+	}
+
+	return cache.KeyOf(info)
+}
+
+// Only the clean verdicts are cached, the other ones must be reported again
+func cachedEntry(key cache.Key, cacheable bool) *cache.Entry {
+	if scanCache == nil || NoCache || !cacheable {
+		return nil
+	}
+
+	if entry, found := scanCache.Get(key); found && entry.Verdict == string(scoring.Clean) {
+		return entry
+	}
+
+	return nil
+}
+
+func saveToCache(key cache.Key, result *Result) {
+	if scanCache == nil {
+		return
+	}
+
+	entry := &cache.Entry{
+		Filename: result.Filename,
+		SHA256:   result.SHA256,
+		Verdict:  string(result.Verdict),
+		CachedAt: time.Now(),
+	}
+
+	if err := scanCache.Put(key, entry); err != nil {
+		logger.Error("Can't cache the result of the analysis : " + err.Error())
+	}
 }
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+var (
+	// stuff that could be put in a config file
+	databasePath  = "/var/lib/octav/cache.db"
+	entriesBucket = []byte("entries")
+	metaBucket    = []byte("meta")
+	versionKey    = []byte("version")
+)
+
+// Key identifies a file in a given state, any modification of the file changes its key
+type Key struct {
+	Device     uint64
+	Inode      uint64
+	Size       int64
+	ModTime    int64
+	ChangeTime int64 // Changes on chmod, chown, rename... and can't be set back by the user like the mtime
+}
+
+func KeyOf(info os.FileInfo) (Key, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return Key{}, false
+	}
+
+	return Key{
+		Device:     uint64(stat.Dev),
+		Inode:      stat.Ino,
+		Size:       stat.Size,
+		ModTime:    time.Unix(stat.Mtim.Unix()).UnixNano(),
+		ChangeTime: time.Unix(stat.Ctim.Unix()).UnixNano(),
+	}, true
+}
+
+func (key Key) bytes() []byte {
+	buffer := make([]byte, 40)
+	binary.BigEndian.PutUint64(buffer[0:], key.Device)
+	binary.BigEndian.PutUint64(buffer[8:], key.Inode)
+	binary.BigEndian.PutUint64(buffer[16:], uint64(key.Size))
+	binary.BigEndian.PutUint64(buffer[24:], uint64(key.ModTime))
+	binary.BigEndian.PutUint64(buffer[32:], uint64(key.ChangeTime))
+	return buffer
+}
+
+type Entry struct {
+	Filename string
+	SHA256   string
+	Verdict  string
+	CachedAt time.Time
+}
+
+type Cache struct {
+	db *bolt.DB
+}
+
+// Open the cache, the entries are dropped if they were computed with another version of the database, rules or policy.
+// It's locked until Close is called, so it should only be kept open while files are being analysed
+func Open(version string) (*Cache, error) {
+	if err := os.MkdirAll(filepath.Dir(databasePath), 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(databasePath, 0600, &bolt.Options{Timeout: time.Second})
+
+	if err == bolt.ErrTimeout {
+		return nil, errors.New("the cache is locked by another OctAV instance")
+	} else if err != nil {
+		return nil, err
+	}
+
+	cache := &Cache{db}
+
+	if err = cache.SetVersion(version); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+// SetVersion drops every entry if the version has changed, such as after a database sync
+func (cache *Cache) SetVersion(version string) error {
+	return cache.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		if string(meta.Get(versionKey)) != version {
+			if err = tx.DeleteBucket(entriesBucket); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+
+			if err = meta.Put(versionKey, []byte(version)); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.CreateBucketIfNotExists(entriesBucket)
+		return err
+	})
+}
+
+func (cache *Cache) Close() error {
+	return cache.db.Close()
+}
+
+func (cache *Cache) Get(key Key) (*Entry, bool) {
+	var entry *Entry
+
+	cache.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(entriesBucket).Get(key.bytes())
+
+		if value == nil {
+			return nil
+		}
+
+		entry = &Entry{}
+
+		if err := json.Unmarshal(value, entry); err != nil {
+			entry = nil // A corrupted entry is a cache miss
+		}
+
+		return nil
+	})
+
+	return entry, entry != nil
+}
+
+// Put may be called by several analyses at the same time, their writes are grouped in a single transaction
+func (cache *Cache) Put(key Key, entry *Entry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return cache.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Put(key.bytes(), value)
+	})
+}
@@ -0,0 +1,192 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// stuff that could be put in a config file
+	databasePath = "/var/lib/octav/history.db"
+	bucketName   = []byte("analyses")
+)
+
+// The database is locked for the duration of a single read or write, another instance may be using it
+const lockTimeout = 5 * time.Second
+
+const (
+	ActionNone        = "none"
+	ActionDetected    = "detected"
+	ActionQuarantined = "quarantined"
+	ActionError       = "error"
+)
+
+type Record struct {
+	ID           uint64
+	Filename     string
+	MD5          string
+	SHA1         string
+	SHA256       string
+	StaticScore  uint
+	DynamicScore uint
+	YaraRules    []string
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	Action       string
+}
+
+func (record Record) String() string {
+	return fmt.Sprintf("[%s] %s\n"+
+		"\tSHA256:\t\t%s\n"+
+		"\tScores:\t\tstatic %d, dynamic %d\n"+
+		"\tYARA rules:\t%v\n"+
+		"\tAction:\t\t%s\n",
+		record.StartedAt.Format(time.RFC3339), record.Filename, record.SHA256,
+		record.StaticScore, record.DynamicScore, record.YaraRules, record.Action)
+}
+
+// Store doesn't keep the database open, so the daemon, the GUI and the command line can share the history
+type Store struct {
+	readOnly bool
+}
+
+// Open checks that the history database can be used, it's created unless readOnly is set
+func Open(readOnly bool) (*Store, error) {
+	if _, err := os.Stat(databasePath); readOnly && os.IsNotExist(err) {
+		return nil, errors.New("no analysis has been recorded yet")
+	}
+
+	store := &Store{readOnly}
+
+	if readOnly {
+		return store, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(databasePath), 0700); err != nil {
+		return nil, err
+	}
+
+	err := store.update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Close is kept for the callers, nothing stays open between two operations
+func (store *Store) Close() error {
+	return nil
+}
+
+// Writers get an exclusive lock, readers a shared one
+func (store *Store) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(databasePath, 0600, &bolt.Options{Timeout: lockTimeout, ReadOnly: readOnly})
+
+	if err == bolt.ErrTimeout {
+		return nil, errors.New("the history is locked by another OctAV instance")
+	}
+
+	return db, err
+}
+
+func (store *Store) update(fn func(*bolt.Tx) error) error {
+	if store.readOnly {
+		return errors.New("the history has been opened read only")
+	}
+
+	db, err := store.open(false)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	return db.Update(fn)
+}
+
+func (store *Store) view(fn func(*bolt.Tx) error) error {
+	db, err := store.open(true)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close() // No need to handle error, database in read only
+
+	return db.View(fn)
+}
+
+func (store *Store) Add(record *Record) error {
+	return store.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		record.ID = id
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(recordKey(id), value)
+	})
+}
+
+// Last returns up to limit records, oldest first. A limit of 0 returns the whole history
+func (store *Store) Last(limit int) ([]Record, error) {
+	var records []Record
+
+	err := store.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+
+		if bucket == nil { // Nothing has been written yet
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+
+		for key, value := cursor.Last(); key != nil; key, value = cursor.Prev() {
+			if limit > 0 && len(records) >= limit {
+				break
+			}
+
+			var record Record
+
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+
+			records = append(records, record)
+		}
+
+		return nil
+	})
+
+	// The cursor went backward
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	return records, err
+}
+
+// Big endian keys keep records sorted by insertion order
+func recordKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
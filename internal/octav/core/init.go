@@ -4,26 +4,108 @@ import (
 	"errors"
 	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/dynamic"
 	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/static"
+	"github.com/OctAVProject/OctAV/internal/octav/core/cache"
+	"github.com/OctAVProject/OctAV/internal/octav/core/history"
+	"github.com/OctAVProject/OctAV/internal/octav/core/scoring"
 	"github.com/OctAVProject/OctAV/internal/octav/logger"
 	"github.com/coreos/go-systemd/dbus"
 	"github.com/hillu/go-yara"
 	"os"
 	"os/exec"
+	"sync"
 )
 
 var yaraGrep *static.YaraGrep
+var hashDatabase *static.HashDatabase
+var ssdeepDatabase *static.SSDeepDatabase
+var tlshDatabase *static.TLSHDatabase
+var importHashDatabase *static.ImportHashDatabase
+var ipDatabase *static.IPDatabase
+var domainDatabase *static.DomainDatabase
+var historyStore *history.Store
+var scanCache *cache.Cache
+var scanCacheUsers int // Analyses running, the cache is closed when the last one ends so other instances can use it
+var scanCacheMutex sync.Mutex
+var policy = &scoring.DefaultPolicy
 var DaemonMode = false
 
+const defaultPolicyPath = "/etc/octav/policy.yml"
+
+var PolicyPath = defaultPolicyPath
+
+// The cached verdicts are ignored, every file is analysed again (the cache is still updated)
+var NoCache = false
+
 // Initialize tools that need to stay available over multiple analysis (Ex: it doesn't make sense to initialize YARA rules every time a new file is being analyzed)
 func Initialize(daemonMode bool) error {
 	var err error
 
+	if err = loadPolicy(); err != nil {
+		return err
+	}
+
 	if yaraGrep, err = static.NewYaraMatcher(); err != nil {
 		return err
 	}
 
+	if hashDatabase, err = static.NewHashDatabase(); err != nil {
+		logger.Error(err.Error())
+		logger.Debug("Trying to fix the error by syncing the database.")
+
+		if err = SyncDatabase(); err != nil {
+			return err
+		}
+
+		if hashDatabase, err = static.NewHashDatabase(); err != nil {
+			return err
+		}
+	}
+
+	if ssdeepDatabase, err = static.NewSSDeepDatabase(); err != nil {
+		logger.Error(err.Error())
+		logger.Debug("Trying to fix the error by syncing the database.")
+
+		if err = SyncDatabase(); err != nil {
+			return err
+		}
+
+		if ssdeepDatabase, err = static.NewSSDeepDatabase(); err != nil {
+			return err
+		}
+	}
+
+	if tlshDatabase, err = static.NewTLSHDatabase(); err != nil {
+		return err
+	}
+
+	if importHashDatabase, err = static.NewImportHashDatabase(); err != nil {
+		return err
+	}
+
+	if ipDatabase, err = static.NewIPDatabase(); err != nil {
+		return err
+	}
+
+	if domainDatabase, err = static.NewDomainDatabase(); err != nil {
+		logger.Error(err.Error())
+		logger.Debug("Trying to fix the error by syncing the database.")
+
+		if err = SyncDatabase(); err != nil {
+			return err
+		}
+
+		if domainDatabase, err = static.NewDomainDatabase(); err != nil {
+			return err
+		}
+	}
+
 	DaemonMode = daemonMode
 
+	// The history is not mandatory to analyse files, another OctAV instance may hold it
+	if historyStore, err = history.Open(false); err != nil {
+		logger.Warning("Analyses won't be saved to the history : " + err.Error())
+	}
+
 	if isUp, err := dynamic.IsSandBoxUp(); !isUp && false {
 
 		if err != nil {
@@ -69,7 +151,67 @@ func Initialize(daemonMode bool) error {
 	return nil
 }
 
+// The default policy file is optional, the built-in policy is used when it doesn't exist
+func loadPolicy() error {
+	if _, err := os.Stat(PolicyPath); os.IsNotExist(err) && PolicyPath == defaultPolicyPath {
+		logger.Debug("No policy file, using the default scoring policy")
+		return nil
+	}
+
+	loadedPolicy, err := scoring.LoadPolicy(PolicyPath)
+	if err != nil {
+		return err
+	}
+
+	policy = loadedPolicy
+	logger.Info("Scoring policy loaded from " + PolicyPath)
+	return nil
+}
+
+// Opens the cache for an analysis, unless another analysis already did. The rules are compiled and the database synced
+// by then, their version is part of the cache's
+func acquireCache() {
+	scanCacheMutex.Lock()
+	defer scanCacheMutex.Unlock()
+
+	if scanCacheUsers == 0 {
+		var err error
+
+		if scanCache, err = cache.Open(databaseVersion()); err != nil {
+			logger.Warning("Scan results won't be cached : " + err.Error())
+		}
+	}
+
+	scanCacheUsers++
+}
+
+func releaseCache() {
+	scanCacheMutex.Lock()
+	defer scanCacheMutex.Unlock()
+
+	scanCacheUsers--
+
+	if scanCacheUsers == 0 && scanCache != nil {
+		if err := scanCache.Close(); err != nil {
+			logger.Error("Can't close the scan cache : " + err.Error())
+		}
+
+		scanCache = nil
+	}
+}
+
+// CurrentPolicy returns the scoring policy in use, the default one until the core is initialized
+func CurrentPolicy() *scoring.Policy {
+	return policy
+}
+
 func Stop() error {
+	if historyStore != nil {
+		if err := historyStore.Close(); err != nil {
+			return err
+		}
+	}
+
 	if err := yara.Finalize(); err != nil {
 		return err
 	}
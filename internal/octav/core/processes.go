@@ -0,0 +1,209 @@
+package core
+
+import (
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core/scoring"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stuff that could be put in a config file
+var procPath = "/proc/"
+
+// A process can map gigabytes, the scan of a single one is stopped past that
+const processScanTimeout = time.Minute
+
+// The kernel appends it to the target of /proc/PID/exe once the executable has been removed from the disk
+const deletedSuffix = " (deleted)"
+
+// Process describes a running process, it's attached to the result of the scan of its memory
+type Process struct {
+	PID        int
+	Executable string // Target of /proc/PID/exe, memfd executables are named "/memfd:NAME"
+	Cmdline    string
+	Deleted    bool `json:",omitempty"` // The executable doesn't exist on disk anymore
+	Replaced   bool `json:",omitempty"` // Another file has taken the place of the executable
+}
+
+func (process Process) String() string {
+	return fmt.Sprintf("PID %v (%s)", process.PID, process.Executable)
+}
+
+// ScanProcesses scans the memory of every running process with the YARA rules, kernel threads and OctAV itself excepted
+func ScanProcesses() []*Result {
+	logger.Header("process scan")
+
+	processes := listProcesses()
+	results := make([]*Result, len(processes))
+
+	jobs := DefaultJobs
+
+	if jobs > maxJobs {
+		jobs = maxJobs
+	}
+
+	queue := make(chan int)
+
+	var workers sync.WaitGroup
+
+	for i := 0; i < jobs; i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for index := range queue {
+				results[index] = scanProcess(processes[index])
+				saveToHistory(results[index].record())
+			}
+		}()
+	}
+
+	for index := range processes {
+		queue <- index
+	}
+
+	close(queue)
+	workers.Wait()
+
+	logger.Info(fmt.Sprintf("%v processes scanned", len(processes)))
+	return results
+}
+
+func listProcesses() []*Process {
+	entries, err := ioutil.ReadDir(procPath)
+
+	if err != nil {
+		logger.Error("Can't list the processes : " + err.Error())
+		return nil
+	}
+
+	// Scanning OctAV would match every rule, they are all in memory. Other instances, such as the daemon, as well
+	var octav os.FileInfo
+
+	if executable, err := os.Executable(); err == nil {
+		octav, _ = os.Stat(executable)
+	}
+
+	var processes []*Process
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+
+		if running, err := os.Stat(filepath.Join(procPath, entry.Name(), "exe")); err == nil && octav != nil && os.SameFile(running, octav) {
+			logger.Debug(fmt.Sprintf("Skipping PID %v : OctAV itself", pid))
+			continue
+		}
+
+		process, err := inspectProcess(pid)
+
+		if err != nil {
+			logger.Debug(fmt.Sprintf("Skipping PID %v : %s", pid, err.Error()))
+			continue
+		}
+
+		processes = append(processes, process)
+	}
+
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].PID < processes[j].PID
+	})
+
+	return processes
+}
+
+// inspectProcess fails for kernel threads, they have no executable, and for the processes that already exited
+func inspectProcess(pid int) (*Process, error) {
+	processPath := filepath.Join(procPath, strconv.Itoa(pid))
+
+	target, err := os.Readlink(filepath.Join(processPath, "exe"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	process := &Process{PID: pid, Executable: strings.TrimSuffix(target, deletedSuffix)}
+
+	if cmdline, err := ioutil.ReadFile(filepath.Join(processPath, "cmdline")); err == nil {
+		process.Cmdline = strings.TrimSpace(strings.Replace(string(cmdline), "\x00", " ", -1))
+	}
+
+	// /proc/PID/exe still leads to the running executable, even once it has been deleted
+	running, err := os.Stat(filepath.Join(processPath, "exe"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The path is relative to the root of the process, such as the one of a container
+	onDisk, err := os.Stat(filepath.Join(processPath, "root", process.Executable))
+
+	switch {
+	case os.IsNotExist(err):
+		process.Deleted = true
+	case err == nil && !os.SameFile(running, onDisk):
+		process.Replaced = true
+	}
+
+	return process, nil
+}
+
+func scanProcess(process *Process) (result *Result) {
+	result = newResult(process.Executable)
+	result.FileType = "process"
+	result.Process = process
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			errStr := fmt.Sprintf("The scan of %s crashed : %v", process, recovered)
+			logger.Error(errStr + "\n" + string(debug.Stack()))
+			result.addError(errStr)
+			result.FinishedAt = time.Now()
+		}
+	}()
+
+	logger.Info("Scanning the memory of " + process.String())
+
+	if process.Deleted {
+		evidence := fmt.Sprintf("%s is running from a deleted executable", process)
+		logger.Danger(evidence)
+		result.scorecard.Add(scoring.StageDynamic, "process.deleted_executable", evidence, policy.Processes.DeletedExecutable)
+	} else if process.Replaced {
+		evidence := fmt.Sprintf("%s is running an executable that has been replaced on disk", process)
+		logger.Warning(evidence)
+		result.scorecard.Add(scoring.StageDynamic, "process.replaced_executable", evidence, policy.Processes.ReplacedExecutable)
+	}
+
+	matches, err := yaraGrep.ScanProc(process.PID, 0, processScanTimeout)
+
+	if err != nil {
+		// Mostly processes that exited meanwhile, or that can't be traced without being root. The anomalies of the
+		// executable are still worth a verdict
+		errStr := fmt.Sprintf("Can't scan the memory of %s : %s", process, err.Error())
+		logger.Debug(errStr)
+		result.Errors = append(result.Errors, errStr)
+	} else {
+		yaraAnalysis(matches, result)
+	}
+
+	result.evaluate()
+	result.FinishedAt = time.Now()
+
+	if result.Verdict == scoring.Malicious || result.Verdict == scoring.Suspicious {
+		logger.Danger(fmt.Sprintf("%s : %s", process, result.Score.Summary()))
+	}
+
+	return result
+}
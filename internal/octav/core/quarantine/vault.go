@@ -0,0 +1,315 @@
+package quarantine
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// stuff that could be put in a config file
+	vaultPath = "/var/lib/octav/quarantine/"
+	indexFile = vaultPath + "index.json"
+)
+
+var vaultMutex sync.Mutex
+
+type Entry struct {
+	ID            string
+	OriginalPath  string
+	Mode          os.FileMode
+	UID           int
+	GID           int
+	MD5           string
+	SHA1          string
+	SHA256        string
+	Reason        string
+	QuarantinedAt time.Time
+	Key           string // XOR key used to neuter the file, hex encoded
+}
+
+func (entry Entry) String() string {
+	return fmt.Sprintf("ID:\t\t%s\n"+
+		"Original path:\t%s\n"+
+		"Mode:\t\t%v\n"+
+		"Owner:\t\t%d:%d\n"+
+		"SHA256:\t\t%s\n"+
+		"Reason:\t\t%s\n"+
+		"Date:\t\t%s\n",
+		entry.ID, entry.OriginalPath, entry.Mode, entry.UID, entry.GID,
+		entry.SHA256, entry.Reason, entry.QuarantinedAt.Format(time.RFC3339))
+}
+
+// Add moves the executable into the vault, its content is XORed with a random key so it can't be run or opened by mistake.
+// The file is read again, it may have changed since its analysis and what's quarantined must be what gets deleted
+func Add(exe *analysis.Executable, reason string) (*Entry, error) {
+	vaultMutex.Lock()
+	defer vaultMutex.Unlock()
+
+	info, err := os.Lstat(exe.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, errors.New(fmt.Sprintf("'%s' is not a regular file", exe.Filename))
+	}
+
+	if err = prepareVault(); err != nil {
+		return nil, err
+	}
+
+	entries, err := loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(exe.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	sha256Sum := sha256.Sum256(content)
+
+	if hex.EncodeToString(sha256Sum[:]) != exe.SHA256 {
+		logger.Warning(fmt.Sprintf("%s changed since its analysis, its current content is quarantined", exe.Filename))
+	}
+
+	md5Sum, sha1Sum := md5.Sum(content), sha1.Sum(content)
+
+	key := make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	entry := Entry{
+		ID:            hex.EncodeToString(id),
+		OriginalPath:  exe.Filename,
+		Mode:          info.Mode(),
+		MD5:           hex.EncodeToString(md5Sum[:]),
+		SHA1:          hex.EncodeToString(sha1Sum[:]),
+		SHA256:        hex.EncodeToString(sha256Sum[:]),
+		Reason:        reason,
+		QuarantinedAt: time.Now(),
+		Key:           hex.EncodeToString(key),
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		entry.UID = int(stat.Uid)
+		entry.GID = int(stat.Gid)
+	}
+
+	if err = ioutil.WriteFile(vaultPath+entry.ID, xor(content, key), 0400); err != nil {
+		return nil, err
+	}
+
+	// The index holds the only copy of the key, the original is only deleted once the index is saved
+	if err = saveIndex(append(entries, entry)); err != nil {
+		os.Remove(vaultPath + entry.ID)
+		return nil, err
+	}
+
+	if err = os.Remove(exe.Filename); err != nil {
+		if rollbackErr := saveIndex(entries); rollbackErr != nil {
+			logger.Error("Can't remove the quarantine entry of " + exe.Filename + " : " + rollbackErr.Error())
+		} else {
+			os.Remove(vaultPath + entry.ID)
+		}
+
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("%s moved to quarantine (ID: %s)", exe.Filename, entry.ID))
+	return &entry, nil
+}
+
+func List() ([]Entry, error) {
+	vaultMutex.Lock()
+	defer vaultMutex.Unlock()
+
+	return loadIndex()
+}
+
+// Restore puts the file back to its original location, with its original mode and owner
+func Restore(id string) (*Entry, error) {
+	vaultMutex.Lock()
+	defer vaultMutex.Unlock()
+
+	entries, entry, err := findEntry(id)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(entry.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(vaultPath + entry.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(entry.OriginalPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, entry.Mode.Perm())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = file.Write(xor(content, key)); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if err = file.Close(); err != nil {
+		return nil, err
+	}
+
+	// The umask may have altered the permissions
+	if err = os.Chmod(entry.OriginalPath, entry.Mode); err != nil {
+		return nil, err
+	}
+
+	if err = os.Lchown(entry.OriginalPath, entry.UID, entry.GID); err != nil {
+		logger.Warning("Can't restore the owner of " + entry.OriginalPath + " : " + err.Error())
+	}
+
+	if err = removeEntry(entries, entry); err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("%s restored from quarantine", entry.OriginalPath))
+	return entry, nil
+}
+
+// Purge definitively deletes a quarantined file
+func Purge(id string) (*Entry, error) {
+	vaultMutex.Lock()
+	defer vaultMutex.Unlock()
+
+	entries, entry, err := findEntry(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = removeEntry(entries, entry); err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("%s purged from quarantine", entry.OriginalPath))
+	return entry, nil
+}
+
+func prepareVault() error {
+	if err := os.MkdirAll(vaultPath, 0700); err != nil {
+		return err
+	}
+
+	// Only root should be able to reach the vault
+	if os.Geteuid() == 0 {
+		if err := os.Chown(vaultPath, 0, 0); err != nil {
+			return err
+		}
+	}
+
+	return os.Chmod(vaultPath, 0700)
+}
+
+func loadIndex() ([]Entry, error) {
+	var entries []Entry
+
+	content, err := ioutil.ReadFile(indexFile)
+
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(content, &entries); err != nil {
+		return nil, errors.New("corrupted quarantine index : " + err.Error())
+	}
+
+	return entries, nil
+}
+
+// The index is written to a temporary file first so it never gets truncated
+func saveIndex(entries []Entry) error {
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpIndexFile := filepath.Join(vaultPath, ".index.json.tmp")
+
+	if err = ioutil.WriteFile(tmpIndexFile, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpIndexFile, indexFile)
+}
+
+func findEntry(id string) ([]Entry, *Entry, error) {
+	entries, err := loadIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range entries {
+		if entries[i].ID == id {
+			return entries, &entries[i], nil
+		}
+	}
+
+	return nil, nil, errors.New(fmt.Sprintf("no quarantined file with ID '%s'", id))
+}
+
+// The index is updated first, a failure leaves the entry as it was. The other way around, it would point to a
+// missing file
+func removeEntry(entries []Entry, entry *Entry) error {
+	var remainingEntries []Entry
+
+	for _, e := range entries {
+		if e.ID != entry.ID {
+			remainingEntries = append(remainingEntries, e)
+		}
+	}
+
+	if err := saveIndex(remainingEntries); err != nil {
+		return err
+	}
+
+	// The entry is gone already, the file is only a leftover
+	if err := os.Remove(vaultPath + entry.ID); err != nil && !os.IsNotExist(err) {
+		logger.Error("Can't remove " + vaultPath + entry.ID + " from the vault : " + err.Error())
+	}
+
+	return nil
+}
+
+func xor(content []byte, key []byte) []byte {
+	result := make([]byte, len(content))
+
+	for i := range content {
+		result[i] = content[i] ^ key[i%len(key)]
+	}
+
+	return result
+}
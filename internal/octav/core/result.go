@@ -0,0 +1,189 @@
+package core
+
+import (
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/static"
+	"github.com/OctAVProject/OctAV/internal/octav/core/cache"
+	"github.com/OctAVProject/OctAV/internal/octav/core/history"
+	"github.com/OctAVProject/OctAV/internal/octav/core/scoring"
+	"github.com/OctAVProject/OctAV/internal/octav/core/unpack"
+	"github.com/hillu/go-yara"
+	"strings"
+	"time"
+)
+
+// On top of the scoring verdicts, a file can't be classified if its analysis failed, or if it's not worth analysing
+const (
+	VerdictError   scoring.Verdict = "error"
+	VerdictSkipped scoring.Verdict = "skipped"
+)
+
+// Past that, the strings of a rule are most likely matching a table or padding, the first ones are enough
+const maxYaraStrings = 20
+
+// In bytes, before escaping
+const maxSnippetLength = 64
+
+type YaraMatch struct {
+	Namespace string
+	Rule      string
+	Tags      []string               `json:",omitempty"`
+	Meta      map[string]interface{} `json:",omitempty"` // Author, description, family...
+	Strings   []YaraString           `json:",omitempty"`
+}
+
+// YaraString is a string of a rule found in the file
+type YaraString struct {
+	Name    string
+	Offset  uint64
+	Snippet string // Matched data, non printable bytes are escaped
+}
+
+func newYaraMatch(match yara.MatchRule) YaraMatch {
+	yaraMatch := YaraMatch{Namespace: match.Namespace, Rule: match.Rule, Tags: match.Tags, Meta: match.Meta}
+
+	for i, matchString := range match.Strings {
+		if i == maxYaraStrings {
+			break
+		}
+
+		yaraMatch.Strings = append(yaraMatch.Strings, YaraString{
+			Name:    matchString.Name,
+			Offset:  matchString.Offset,
+			Snippet: snippet(matchString.Data),
+		})
+	}
+
+	return yaraMatch
+}
+
+func snippet(data []byte) string {
+	var builder strings.Builder
+
+	for i, c := range data {
+		if i == maxSnippetLength {
+			builder.WriteString("...")
+			break
+		}
+
+		if c >= 0x20 && c < 0x7f && c != '\\' {
+			builder.WriteByte(c)
+		} else {
+			builder.WriteString(fmt.Sprintf("\\x%02x", c))
+		}
+	}
+
+	return builder.String()
+}
+
+// Result gathers everything that has been found about a single file
+type Result struct {
+	Filename    string
+	FileType    string
+	MIME        string
+	MD5         string
+	SHA1        string
+	SHA256      string
+	SSDeep      string
+	TLSH        string `json:",omitempty"`
+	ImportHash  string `json:",omitempty"`
+	Score       scoring.Breakdown
+	YaraMatches []YaraMatch
+	IOCs        *static.IOCs `json:",omitempty"` // Found in the strings, for the triage
+	Errors      []string
+	SkipReason  string `json:",omitempty"`
+	Cached      bool   `json:",omitempty"` // The verdict comes from a previous analysis of the same unchanged file
+	Package     string `json:",omitempty"` // Package owning the file, according to the package manager
+	Trusted     bool   `json:",omitempty"` // Unmodified since its package installed it, it hasn't been analysed
+	Verdict     scoring.Verdict
+	Action      string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Members     []*Result `json:",omitempty"` // Files found inside an archive, named "archive!member"
+	Process     *Process  `json:",omitempty"` // Running process whose memory has been scanned
+
+	scorecard *scoring.Scorecard
+	depth     int            // Number of archives the file is nested in
+	budget    *unpack.Budget // Shared by an archive and every archive nested in it
+	progress  float64
+}
+
+func newResult(filename string) *Result {
+	return &Result{
+		Filename:  filename,
+		Verdict:   scoring.Clean,
+		Action:    history.ActionNone,
+		StartedAt: time.Now(),
+		scorecard: scoring.NewScorecard(policy.Thresholds),
+	}
+}
+
+func (result *Result) newMember(name string) *Result {
+	member := newResult(name)
+	member.depth = result.depth + 1
+	member.budget = result.budget
+	return member
+}
+
+func (result *Result) setExecutable(exe *analysis.Executable) {
+	result.FileType = exe.Handler.Name
+	result.MIME = exe.MIME
+	result.MD5, result.SHA1, result.SHA256, result.SSDeep = exe.MD5, exe.SHA1, exe.SHA256, exe.SSDeep
+	result.TLSH, result.ImportHash = exe.TLSH, exe.ImportHash
+}
+
+// Computes the verdict from the findings collected so far
+func (result *Result) evaluate() scoring.Breakdown {
+	result.Score = result.scorecard.Breakdown()
+
+	if result.Verdict != VerdictError && result.Verdict != VerdictSkipped {
+		result.Verdict = result.Score.Verdict
+	}
+
+	return result.Score
+}
+
+func (result *Result) addError(msg string) {
+	result.Errors = append(result.Errors, msg)
+	result.Verdict = VerdictError
+	result.Action = history.ActionError
+}
+
+func (result *Result) skip(reason string) {
+	result.SkipReason = reason
+	result.Verdict = VerdictSkipped
+}
+
+func (result *Result) loadCache(entry *cache.Entry) {
+	result.SHA256 = entry.SHA256
+	result.Verdict = scoring.Verdict(entry.Verdict)
+	result.Score.Verdict = result.Verdict
+	result.Cached = true
+	result.FinishedAt = time.Now()
+}
+
+func (result *Result) trust() {
+	result.Trusted = true
+	result.FinishedAt = time.Now()
+}
+
+func (result *Result) record() *history.Record {
+	record := &history.Record{
+		Filename:     result.Filename,
+		MD5:          result.MD5,
+		SHA1:         result.SHA1,
+		SHA256:       result.SHA256,
+		StaticScore:  result.Score.StaticTotal,
+		DynamicScore: result.Score.DynamicTotal,
+		StartedAt:    result.StartedAt,
+		FinishedAt:   result.FinishedAt,
+		Action:       result.Action,
+	}
+
+	for _, match := range result.YaraMatches {
+		record.YaraRules = append(record.YaraRules, match.Namespace+"/"+match.Rule)
+	}
+
+	return record
+}
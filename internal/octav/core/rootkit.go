@@ -0,0 +1,68 @@
+package core
+
+import (
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/rootkit"
+	"github.com/OctAVProject/OctAV/internal/octav/core/scoring"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"strings"
+	"time"
+)
+
+// RootkitCheck looks for what rootkits hide, every process, module, file or library concerned gets a result
+func RootkitCheck() []*Result {
+	logger.Header("rootkit check")
+
+	var anomalies []rootkit.Anomaly
+	anomalies = append(anomalies, rootkit.HiddenProcesses()...)
+	anomalies = append(anomalies, rootkit.HiddenModules()...)
+	anomalies = append(anomalies, rootkit.HiddenFiles()...)
+	anomalies = append(anomalies, rootkit.PreloadedLibraries()...)
+
+	weights := map[string]uint{
+		rootkit.CheckHiddenProcess: policy.Rootkit.HiddenProcess,
+		rootkit.CheckHiddenModule:  policy.Rootkit.HiddenModule,
+		rootkit.CheckHiddenFile:    policy.Rootkit.HiddenFile,
+		rootkit.CheckPreload:       policy.Rootkit.Preload,
+	}
+
+	var results []*Result
+	bySubject := make(map[string]*Result)
+	evidences := make(map[string][]string) // Subject and check -> evidences, a check only counts once for a subject
+
+	for _, anomaly := range anomalies {
+		logger.Danger(anomaly.String())
+
+		result, found := bySubject[anomaly.Subject]
+
+		if !found {
+			result = newResult(anomaly.Subject)
+			result.FileType = "rootkit check"
+			bySubject[anomaly.Subject] = result
+			results = append(results, result)
+		}
+
+		key := anomaly.Subject + "\x00" + anomaly.Check
+		evidences[key] = append(evidences[key], anomaly.Evidence)
+	}
+
+	for _, result := range results {
+		for _, check := range []string{rootkit.CheckHiddenProcess, rootkit.CheckHiddenModule, rootkit.CheckHiddenFile, rootkit.CheckPreload} {
+			if found := evidences[result.Filename+"\x00"+check]; len(found) > 0 {
+				result.scorecard.Add(scoring.StageStatic, "rootkit."+check, strings.Join(found, ", "), weights[check])
+			}
+		}
+
+		result.evaluate()
+		result.FinishedAt = time.Now()
+		saveToHistory(result.record())
+	}
+
+	if len(results) == 0 {
+		logger.Info("No sign of a rootkit.")
+	} else {
+		logger.Info(fmt.Sprintf("%v anomalies found", len(anomalies)))
+	}
+
+	return results
+}
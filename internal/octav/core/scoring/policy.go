@@ -0,0 +1,356 @@
+package scoring
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Policy maps every kind of finding to a weight, along with the thresholds leading to a verdict
+type Policy struct {
+	Thresholds  Thresholds        `yaml:"thresholds"`
+	Hashes      HashPolicy        `yaml:"hashes"`
+	IOCs        IOCPolicy         `yaml:"iocs"`
+	SSDeep      []SSDeepBand      `yaml:"ssdeep"`
+	TLSH        []TLSHBand        `yaml:"tlsh"`
+	ImportHash  HashPolicy        `yaml:"import_hash"`
+	ML          MLPolicy          `yaml:"ml"`
+	Yara        []YaraPolicy      `yaml:"yara"`
+	YaraMeta    YaraMetaPolicy    `yaml:"yara_meta"`
+	Archives    ArchivePolicy     `yaml:"archives"`
+	ELF         ELFPolicy         `yaml:"elf"`
+	Processes   ProcessPolicy     `yaml:"processes"`
+	Persistence PersistencePolicy `yaml:"persistence"`
+	Rootkit     RootkitPolicy     `yaml:"rootkit"`
+	Integrity   IntegrityPolicy   `yaml:"integrity"`
+}
+
+type HashPolicy struct {
+	Weight uint `yaml:"weight"`
+}
+
+type IOCPolicy struct {
+	Domain uint `yaml:"domain"`
+	IP     uint `yaml:"ip"`
+}
+
+// SSDeepBand gives a weight to similarities between Min and Max (inclusive)
+type SSDeepBand struct {
+	Min    int  `yaml:"min"`
+	Max    int  `yaml:"max"`
+	Weight uint `yaml:"weight"`
+}
+
+// TLSHBand gives a weight to distances between Min and Max (inclusive), 0 being identical
+type TLSHBand struct {
+	Min    int  `yaml:"min"`
+	Max    int  `yaml:"max"`
+	Weight uint `yaml:"weight"`
+}
+
+// Above the threshold, the prediction is worth Weight, below it's proportional to the prediction
+type MLPolicy struct {
+	Threshold float64 `yaml:"threshold"`
+	Weight    uint    `yaml:"weight"`
+}
+
+// Weights given to an archive because of its members
+type ArchivePolicy struct {
+	MaliciousMember  uint `yaml:"malicious_member"`
+	SuspiciousMember uint `yaml:"suspicious_member"`
+	LimitExceeded    uint `yaml:"limit_exceeded"` // Too big, too many files or too deep, it may be an archive bomb
+}
+
+// Weights of the anomalies found in the structure of ELF files
+type ELFPolicy struct {
+	MaxEntropy         float64 `yaml:"max_entropy"` // Above it, executable sections are considered packed
+	RWXSegment         uint    `yaml:"rwx_segment"`
+	HighEntropy        uint    `yaml:"high_entropy"`
+	Stripped           uint    `yaml:"stripped"`
+	NoSectionHeaders   uint    `yaml:"no_section_headers"`
+	MalformedHeaders   uint    `yaml:"malformed_headers"`
+	EntryOutsideCode   uint    `yaml:"entry_outside_code"`
+	UnusualInterpreter uint    `yaml:"unusual_interpreter"`
+	AntiDebug          uint    `yaml:"anti_debug"`
+	ReverseShell       uint    `yaml:"reverse_shell"`
+}
+
+// Weights of the anomalies found while scanning the running processes
+type ProcessPolicy struct {
+	DeletedExecutable  uint `yaml:"deleted_executable"`  // Such as malware removing itself or running from a memfd
+	ReplacedExecutable uint `yaml:"replaced_executable"` // The file on disk changed, upgrades do it too
+}
+
+// Weights given to the files started by a persistence mechanism (cron, systemd, shell profiles...)
+type PersistencePolicy struct {
+	WritableTarget  uint `yaml:"writable_target"`  // Anyone can replace what is started
+	TemporaryTarget uint `yaml:"temporary_target"` // Started from /tmp, /var/tmp or /dev/shm
+	Preload         uint `yaml:"preload"`          // Listed in /etc/ld.so.preload, loaded into every process
+}
+
+// Weights of the anomalies found by the rootkit checks
+type RootkitPolicy struct {
+	HiddenProcess uint `yaml:"hidden_process"`
+	HiddenModule  uint `yaml:"hidden_module"`
+	HiddenFile    uint `yaml:"hidden_file"`
+	Preload       uint `yaml:"preload"` // Library in /etc/ld.so.preload or in the LD_PRELOAD of a process
+}
+
+// Weights of the files that differ from the version of their package
+type IntegrityPolicy struct {
+	ModifiedFile uint `yaml:"modified_file"`
+}
+
+// YaraPolicy applies to the rules matching both globs, the first matching entry wins
+type YaraPolicy struct {
+	Namespace   string `yaml:"namespace"`
+	Rule        string `yaml:"rule"`
+	Weight      uint   `yaml:"weight"`
+	Description string `yaml:"description"`
+	Ignore      bool   `yaml:"ignore"` // The match isn't even reported
+}
+
+// Rules can set their own weight with a "score" or a "severity" meta, it replaces the weight given by the yara entries
+type YaraMetaPolicy struct {
+	MaxScore   uint            `yaml:"max_score"`
+	Severities map[string]uint `yaml:"severities"` // Lowercase, the severities of the rules are compared case insensitively
+}
+
+// DefaultPolicy is used when no policy file is provided
+var DefaultPolicy = Policy{
+	Thresholds: DefaultThresholds,
+	Hashes:     HashPolicy{Weight: 100},
+	IOCs:       IOCPolicy{Domain: 70, IP: 70},
+	SSDeep:     []SSDeepBand{{Min: 91, Max: 100, Weight: 80}},
+	TLSH:       []TLSHBand{{Min: 0, Max: 30, Weight: 80}, {Min: 31, Max: 50, Weight: 40}},
+	ImportHash: HashPolicy{Weight: 50},
+	ML:         MLPolicy{Threshold: 0.88, Weight: 100},
+	Yara: []YaraPolicy{
+		{Namespace: "*", Rule: "is__elf", Ignore: true},
+		{Namespace: "malware", Rule: "with_sqlite", Weight: 0, Description: "Embeds SQLite"},
+		{Namespace: "malware", Rule: "suspicious_packer_section", Weight: 50, Description: "Suspicious packed binary detected"},
+		{Namespace: "malware", Rule: "ldpreload", Weight: 20, Description: "LD_PRELOAD detected"},
+		{Namespace: "malware", Rule: "*", Weight: 100, Description: "Matched a rule meaning it's a malware"},
+		{Namespace: "packer", Rule: "UPX*", Weight: 50, Description: "Suspicious packed binary detected"},
+		{Namespace: "packer", Rule: "*", Weight: 0},
+		{Namespace: "anti-debug/vm", Rule: "vmdetect_misc", Weight: 60, Description: "The binary tries to detect if it's running in a VM"},
+		{Namespace: "anti-debug/vm", Rule: "network_*", Weight: 20, Description: "The binary uses typical malware communications"},
+		{Namespace: "anti-debug/vm", Rule: "*", Weight: 40},
+		{Namespace: "local/*", Rule: "*", Weight: 100, Description: "Matched a local rule"},
+	},
+	YaraMeta: YaraMetaPolicy{
+		MaxScore:   100,
+		Severities: map[string]uint{"low": 20, "medium": 50, "high": 80, "critical": 100},
+	},
+	Archives: ArchivePolicy{MaliciousMember: 100, SuspiciousMember: 50, LimitExceeded: 50},
+	ELF: ELFPolicy{
+		MaxEntropy:         7.2,
+		RWXSegment:         40,
+		HighEntropy:        40,
+		Stripped:           5,
+		NoSectionHeaders:   40,
+		MalformedHeaders:   50,
+		EntryOutsideCode:   40,
+		UnusualInterpreter: 50,
+		AntiDebug:          20,
+		ReverseShell:       30,
+	},
+	Processes:   ProcessPolicy{DeletedExecutable: 50, ReplacedExecutable: 20},
+	Persistence: PersistencePolicy{WritableTarget: 50, TemporaryTarget: 60, Preload: 40},
+	Rootkit:     RootkitPolicy{HiddenProcess: 100, HiddenModule: 100, HiddenFile: 100, Preload: 50},
+	Integrity:   IntegrityPolicy{ModifiedFile: 80},
+}
+
+// LoadPolicy reads and validates a YAML policy, the sections that are not specified keep their default value
+func LoadPolicy(filename string) (*Policy, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := DefaultPolicy
+
+	// The YAML decoder would fill the default map (and reject its keys), given severities replace the default ones
+	policy.YaraMeta.Severities = nil
+
+	if err = yaml.UnmarshalStrict(content, &policy); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid policy '%s' : %s", filename, err.Error()))
+	}
+
+	if policy.YaraMeta.Severities == nil {
+		policy.YaraMeta.Severities = DefaultPolicy.YaraMeta.Severities
+	}
+
+	if err = policy.Validate(); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid policy '%s' : %s", filename, err.Error()))
+	}
+
+	return &policy, nil
+}
+
+// Validate lists every issue of the policy at once
+func (policy *Policy) Validate() error {
+	var issues []string
+
+	thresholds := policy.Thresholds
+
+	// A suspicious threshold of 0 would make every file suspicious, even the ones without any finding
+	if thresholds.Static == 0 || thresholds.Dynamic == 0 || thresholds.Combined == 0 || thresholds.Suspicious == 0 {
+		issues = append(issues, "thresholds: static, dynamic, combined and suspicious must be greater than 0")
+	}
+
+	if thresholds.Suspicious > thresholds.Static || thresholds.Suspicious > thresholds.Combined {
+		issues = append(issues, "thresholds.suspicious: must be lower than the static and combined thresholds")
+	}
+
+	for i, band := range policy.SSDeep {
+		if band.Min < 0 || band.Max > 100 || band.Min > band.Max {
+			issues = append(issues, fmt.Sprintf("ssdeep[%d]: expected 0 <= min <= max <= 100, got min %d and max %d", i, band.Min, band.Max))
+		}
+
+		for j, other := range policy.SSDeep[:i] {
+			if band.Min <= other.Max && other.Min <= band.Max {
+				issues = append(issues, fmt.Sprintf("ssdeep[%d]: overlaps with ssdeep[%d]", i, j))
+			}
+		}
+	}
+
+	for i, band := range policy.TLSH {
+		if band.Min < 0 || band.Min > band.Max {
+			issues = append(issues, fmt.Sprintf("tlsh[%d]: expected 0 <= min <= max, got min %d and max %d", i, band.Min, band.Max))
+		}
+
+		for j, other := range policy.TLSH[:i] {
+			if band.Min <= other.Max && other.Min <= band.Max {
+				issues = append(issues, fmt.Sprintf("tlsh[%d]: overlaps with tlsh[%d]", i, j))
+			}
+		}
+	}
+
+	if policy.ML.Threshold <= 0 || policy.ML.Threshold > 1 {
+		issues = append(issues, fmt.Sprintf("ml.threshold: must be in ]0, 1], got %v", policy.ML.Threshold))
+	}
+
+	if policy.ELF.MaxEntropy <= 0 || policy.ELF.MaxEntropy > 8 {
+		issues = append(issues, fmt.Sprintf("elf.max_entropy: must be in ]0, 8], got %v", policy.ELF.MaxEntropy))
+	}
+
+	for i, yaraPolicy := range policy.Yara {
+		if yaraPolicy.Namespace == "" || yaraPolicy.Rule == "" {
+			issues = append(issues, fmt.Sprintf("yara[%d]: namespace and rule are mandatory (use '*' to match everything)", i))
+			continue
+		}
+
+		if _, err := globMatch(yaraPolicy.Namespace, ""); err != nil {
+			issues = append(issues, fmt.Sprintf("yara[%d].namespace: invalid glob '%s'", i, yaraPolicy.Namespace))
+		}
+
+		if _, err := globMatch(yaraPolicy.Rule, ""); err != nil {
+			issues = append(issues, fmt.Sprintf("yara[%d].rule: invalid glob '%s'", i, yaraPolicy.Rule))
+		}
+	}
+
+	for severity := range policy.YaraMeta.Severities {
+		if severity != strings.ToLower(severity) {
+			issues = append(issues, fmt.Sprintf("yara_meta.severities: '%s' must be lowercase", severity))
+		}
+	}
+
+	if len(issues) > 0 {
+		return errors.New(strings.Join(issues, ", "))
+	}
+
+	return nil
+}
+
+// SSDeepWeight returns the weight of the band the similarity falls in
+func (policy *Policy) SSDeepWeight(similarity int) (uint, bool) {
+	for _, band := range policy.SSDeep {
+		if similarity >= band.Min && similarity <= band.Max {
+			return band.Weight, true
+		}
+	}
+
+	return 0, false
+}
+
+// TLSHWeight returns the weight of the band the distance falls in
+func (policy *Policy) TLSHWeight(distance int) (uint, bool) {
+	for _, band := range policy.TLSH {
+		if distance >= band.Min && distance <= band.Max {
+			return band.Weight, true
+		}
+	}
+
+	return 0, false
+}
+
+func (policy *Policy) MLWeight(prediction float64) uint {
+	if prediction > policy.ML.Threshold {
+		return policy.ML.Weight
+	}
+
+	return uint(prediction * float64(policy.ML.Weight) / policy.ML.Threshold)
+}
+
+// YaraRule returns the first entry matching the rule, nil if the policy doesn't know about it
+func (policy *Policy) YaraRule(namespace string, rule string) *YaraPolicy {
+	for i, yaraPolicy := range policy.Yara {
+		namespaceMatches, _ := globMatch(yaraPolicy.Namespace, namespace)
+		ruleMatches, _ := globMatch(yaraPolicy.Rule, rule)
+
+		if namespaceMatches && ruleMatches {
+			return &policy.Yara[i]
+		}
+	}
+
+	return nil
+}
+
+// YaraMetaWeight returns the weight a rule gives itself with its "score" (capped) or "severity" meta, if any
+func (policy *Policy) YaraMetaWeight(meta map[string]interface{}) (uint, bool) {
+	if score, found := metaInteger(meta["score"]); found {
+		if score < 0 {
+			return 0, true
+		}
+
+		if uint(score) > policy.YaraMeta.MaxScore {
+			return policy.YaraMeta.MaxScore, true
+		}
+
+		return uint(score), true
+	}
+
+	if severity, isString := meta["severity"].(string); isString {
+		weight, known := policy.YaraMeta.Severities[strings.ToLower(strings.TrimSpace(severity))]
+		return weight, known
+	}
+
+	return 0, false
+}
+
+// Rule authors write scores both as integers and as strings
+func metaInteger(value interface{}) (int64, bool) {
+	switch value := value.(type) {
+	case int:
+		return int64(value), true
+	case int32:
+		return int64(value), true
+	case int64:
+		return value, true
+	case string:
+		integer, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		return integer, err == nil
+	}
+
+	return 0, false
+}
+
+// Same as path.Match, except that '*' also matches '/' (namespaces such as "anti-debug/vm" contain some)
+func globMatch(pattern string, name string) (bool, error) {
+	return path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(name, "/", "\x00"))
+}
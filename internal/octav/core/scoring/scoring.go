@@ -0,0 +1,134 @@
+package scoring
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Verdict string
+
+const (
+	Clean      Verdict = "clean"
+	Suspicious Verdict = "suspicious"
+	Malicious  Verdict = "malicious"
+)
+
+const (
+	StageStatic  = "static"
+	StageDynamic = "dynamic"
+)
+
+// Finding is a single reason for a file's score to grow
+type Finding struct {
+	Stage    string
+	RuleID   string
+	Evidence string
+	Weight   uint
+}
+
+func (finding Finding) String() string {
+	return fmt.Sprintf("+%v\t%s\t%s", finding.Weight, finding.RuleID, finding.Evidence)
+}
+
+// Thresholds above which a file is considered malicious (or suspicious)
+type Thresholds struct {
+	Static     uint
+	Dynamic    uint
+	Combined   uint
+	Suspicious uint
+}
+
+var DefaultThresholds = Thresholds{
+	Static:     100,
+	Dynamic:    100,
+	Combined:   170,
+	Suspicious: 50,
+}
+
+// Breakdown explains a verdict : every finding along with the totals it led to
+type Breakdown struct {
+	Findings     []Finding
+	StaticTotal  uint
+	DynamicTotal uint
+	Total        uint
+	Verdict      Verdict
+}
+
+func (breakdown Breakdown) String() string {
+	var builder strings.Builder
+
+	builder.WriteString(fmt.Sprintf("Verdict: %s (static %v, dynamic %v, total %v)\n",
+		breakdown.Verdict, breakdown.StaticTotal, breakdown.DynamicTotal, breakdown.Total))
+
+	for _, finding := range breakdown.Findings {
+		builder.WriteString("\t" + finding.String() + "\n")
+	}
+
+	return builder.String()
+}
+
+// Summary is a one line version of the breakdown, listing the rules that contributed to the verdict
+func (breakdown Breakdown) Summary() string {
+	var rules []string
+
+	for _, finding := range breakdown.Findings {
+		if finding.Weight > 0 {
+			rules = append(rules, fmt.Sprintf("%s +%v", finding.RuleID, finding.Weight))
+		}
+	}
+
+	return fmt.Sprintf("%s with a score of %v (%s)", breakdown.Verdict, breakdown.Total, strings.Join(rules, ", "))
+}
+
+// Scorecard collects the findings of the analyses of a single file
+type Scorecard struct {
+	thresholds Thresholds
+	findings   []Finding
+}
+
+func NewScorecard(thresholds Thresholds) *Scorecard {
+	return &Scorecard{thresholds: thresholds}
+}
+
+func (scorecard *Scorecard) Add(stage string, ruleID string, evidence string, weight uint) {
+	scorecard.findings = append(scorecard.findings, Finding{
+		Stage:    stage,
+		RuleID:   ruleID,
+		Evidence: evidence,
+		Weight:   weight,
+	})
+}
+
+func (scorecard *Scorecard) Total(stage string) uint {
+	var total uint
+
+	for _, finding := range scorecard.findings {
+		if finding.Stage == stage {
+			total += finding.Weight
+		}
+	}
+
+	return total
+}
+
+func (scorecard *Scorecard) Breakdown() Breakdown {
+	breakdown := Breakdown{
+		Findings:     append([]Finding(nil), scorecard.findings...),
+		StaticTotal:  scorecard.Total(StageStatic),
+		DynamicTotal: scorecard.Total(StageDynamic),
+	}
+
+	breakdown.Total = breakdown.StaticTotal + breakdown.DynamicTotal
+
+	if breakdown.StaticTotal >= scorecard.thresholds.Static ||
+		breakdown.DynamicTotal >= scorecard.thresholds.Dynamic ||
+		breakdown.Total >= scorecard.thresholds.Combined {
+		breakdown.Verdict = Malicious
+	} else if breakdown.Total >= scorecard.thresholds.Suspicious {
+		breakdown.Verdict = Suspicious
+	} else {
+		breakdown.Verdict = Clean
+	}
+
+	return breakdown
+}
@@ -1,11 +1,39 @@
 package core
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/static"
 	"github.com/OctAVProject/OctAV/internal/octav/logger"
 	"gopkg.in/src-d/go-git.v4"
+	"sync"
 )
 
+// Bumped when the way files are analysed changes, so the cached verdicts are dropped
+const analyserVersion = "1"
+
+// Several analyses may try to fix the database at the same time
+var syncMutex sync.Mutex
+
+// databaseVersion identifies everything a verdict depends on : the synced database, the compiled YARA rules and the policy
+func databaseVersion() string {
+	head := "unknown"
+
+	if repository, err := git.PlainOpen("files"); err == nil {
+		if ref, err := repository.Head(); err == nil {
+			head = ref.Hash().String()
+		}
+	}
+
+	version := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%+v", analyserVersion, head, static.RulesVersion(), *policy)))
+	return hex.EncodeToString(version[:])
+}
+
 func SyncDatabase() error {
+	syncMutex.Lock()
+	defer syncMutex.Unlock()
+
 	logger.Info("Start syncing database...")
 
 	repoPath := "files"
@@ -59,5 +87,16 @@ func SyncDatabase() error {
 	}
 
 	logger.Debug("Latest commit : " + ref.Hash().String())
+
+	// The verdicts cached before the sync may not hold anymore, the cache checks the version when it's opened otherwise
+	scanCacheMutex.Lock()
+	defer scanCacheMutex.Unlock()
+
+	if scanCache != nil {
+		if err = scanCache.SetVersion(databaseVersion()); err != nil {
+			logger.Error("Can't invalidate the scan cache : " + err.Error())
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,119 @@
+package unpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"github.com/blakesmith/ar"
+	"github.com/bodgit/sevenzip"
+	"io"
+)
+
+func unpackTar(tarball io.Reader, budget *Budget, yield func(Member)) error {
+	reader := tar.NewReader(tarball)
+
+	for {
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		memberContent, err := budget.read(reader)
+		if err != nil {
+			return err
+		}
+
+		yield(Member{Name: memberName(header.Name), Content: memberContent})
+	}
+}
+
+func unpackZip(content []byte, budget *Budget, yield func(Member)) error {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		if file.Flags&0x1 != 0 { // Encrypted, it can't be analysed
+			continue
+		}
+
+		memberReader, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		memberContent, err := budget.read(memberReader)
+		memberReader.Close()
+
+		if err != nil {
+			return err
+		}
+
+		yield(Member{Name: memberName(file.Name), Content: memberContent})
+	}
+
+	return nil
+}
+
+func unpack7z(content []byte, budget *Budget, yield func(Member)) error {
+	reader, err := sevenzip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		memberReader, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		memberContent, err := budget.read(memberReader)
+		memberReader.Close()
+
+		if err != nil {
+			return err
+		}
+
+		yield(Member{Name: memberName(file.Name), Content: memberContent})
+	}
+
+	return nil
+}
+
+// Debian packages are ar archives holding a control and a data tarball
+func unpackAr(content []byte, budget *Budget, yield func(Member)) error {
+	reader := ar.NewReader(bytes.NewReader(content))
+
+	for {
+		header, err := reader.Next()
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		memberContent, err := budget.read(reader)
+		if err != nil {
+			return err
+		}
+
+		yield(Member{Name: memberName(header.Name), Content: memberContent})
+	}
+}
@@ -0,0 +1,148 @@
+package unpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// See https://rpm-software-management.github.io/rpm/manual/format.html
+const (
+	rpmLeadSize      = 96
+	rpmHeaderMagic   = "\x8e\xad\xe8\x01"
+	rpmHeaderSize    = 16 // magic, reserved, number of index entries, size of the data
+	rpmIndexSize     = 16
+	cpioHeaderSize   = 110
+	cpioTrailer      = "TRAILER!!!"
+	cpioMaxNameSize  = 4096
+	cpioRegularFile  = 0100000
+	cpioFileTypeMask = 0170000
+)
+
+// The payload of a RPM package is a compressed cpio archive, located after the lead and the signature and main headers
+func unpackRPM(content []byte, budget *Budget, yield func(Member)) error {
+	offset := rpmLeadSize
+
+	signatureSize, err := rpmHeaderLength(content, offset)
+	if err != nil {
+		return errors.New("invalid RPM signature : " + err.Error())
+	}
+
+	offset += signatureSize
+	offset += (8 - offset%8) % 8 // The signature is padded to 8 bytes
+
+	headerSize, err := rpmHeaderLength(content, offset)
+	if err != nil {
+		return errors.New("invalid RPM header : " + err.Error())
+	}
+
+	offset += headerSize
+	payload := content[offset:]
+
+	for format, newReader := range streamFormats {
+		if !payloadMatches(format, payload) {
+			continue
+		}
+
+		reader, err := newReader(bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+
+		defer reader.Close()
+		return unpackCpio(bufio.NewReader(reader), budget, yield)
+	}
+
+	return errors.New("unsupported RPM payload compression")
+}
+
+func rpmHeaderLength(content []byte, offset int) (int, error) {
+	if len(content) < offset+rpmHeaderSize || string(content[offset:offset+4]) != rpmHeaderMagic {
+		return 0, errors.New("bad magic")
+	}
+
+	entries := binary.BigEndian.Uint32(content[offset+8:])
+	dataSize := binary.BigEndian.Uint32(content[offset+12:])
+	length := rpmHeaderSize + int(entries)*rpmIndexSize + int(dataSize)
+
+	if length < 0 || offset+length > len(content) {
+		return 0, errors.New("truncated")
+	}
+
+	return length, nil
+}
+
+var payloadMagics = map[string]string{
+	"gzip":  "\x1f\x8b",
+	"bzip2": "BZh",
+	"xz":    "\xfd7zXZ\x00",
+	"zstd":  "\x28\xb5\x2f\xfd",
+}
+
+func payloadMatches(format string, payload []byte) bool {
+	magic := payloadMagics[format]
+	return magic != "" && bytes.HasPrefix(payload, []byte(magic))
+}
+
+// Only the "new ASCII" format is handled, it's the one used by rpm
+func unpackCpio(reader *bufio.Reader, budget *Budget, yield func(Member)) error {
+	header := make([]byte, cpioHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return err
+		}
+
+		magic := string(header[:6])
+
+		if magic != "070701" && magic != "070702" {
+			return errors.New(fmt.Sprintf("invalid cpio magic '%s'", magic))
+		}
+
+		mode, _ := strconv.ParseUint(string(header[14:22]), 16, 32)
+		fileSize, _ := strconv.ParseInt(string(header[54:62]), 16, 64)
+		nameSize, _ := strconv.ParseInt(string(header[94:102]), 16, 64)
+
+		if nameSize > cpioMaxNameSize {
+			return errors.New("invalid cpio file name size")
+		}
+
+		// The name is NUL terminated, and the header and name are padded to 4 bytes
+		name := make([]byte, nameSize+(4-(cpioHeaderSize+nameSize)%4)%4)
+		if _, err := io.ReadFull(reader, name); err != nil {
+			return err
+		}
+
+		filename := string(bytes.TrimRight(name, "\x00"))
+
+		if filename == cpioTrailer {
+			return nil
+		}
+
+		padding := (4 - fileSize%4) % 4
+
+		if mode&cpioFileTypeMask == cpioRegularFile {
+			data, err := budget.read(io.LimitReader(reader, fileSize))
+			if err != nil {
+				return err
+			}
+
+			if int64(len(data)) != fileSize {
+				return io.ErrUnexpectedEOF
+			}
+
+			yield(Member{Name: memberName(filename), Content: data})
+		} else if _, err := io.CopyN(ioutil.Discard, reader, fileSize); err != nil {
+			return err
+		}
+
+		if _, err := io.CopyN(ioutil.Discard, reader, padding); err != nil {
+			return err
+		}
+	}
+}
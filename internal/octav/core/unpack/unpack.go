@@ -0,0 +1,193 @@
+package unpack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// Limits protect against archive bombs, they apply to an archive and everything nested in it
+type Limits struct {
+	MaxDepth int     // Archives inside archives
+	MaxSize  int64   // Total size of the extracted members, in bytes
+	MaxRatio float64 // Total size of the extracted members divided by the size of the archive
+	MaxFiles int
+}
+
+// Small archives can legitimately have a high compression ratio, such as text files
+const ratioFloor = 16 * 1024 * 1024
+
+// stuff that could be put in a config file
+var DefaultLimits = Limits{
+	MaxDepth: 5,
+	MaxSize:  512 * 1024 * 1024,
+	MaxRatio: 100,
+	MaxFiles: 10000,
+}
+
+// LimitError means the extraction has been stopped because the archive looks like a bomb
+type LimitError struct {
+	Reason string
+}
+
+func (err *LimitError) Error() string {
+	return err.Reason
+}
+
+// Member is a regular file extracted from an archive, Name is its path inside the archive
+type Member struct {
+	Name    string
+	Content []byte
+}
+
+// Budget keeps track of what has been extracted from an archive and the ones nested in it
+type Budget struct {
+	limits      Limits
+	archiveSize int64
+	size        int64
+	files       int
+}
+
+func NewBudget(limits Limits, archiveSize int64) *Budget {
+	return &Budget{limits: limits, archiveSize: archiveSize}
+}
+
+// Stream formats only hold a single file
+var streamFormats = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gzip": func(reader io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(reader)
+	},
+	"bzip2": func(reader io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bzip2.NewReader(reader)), nil
+	},
+	"xz": func(reader io.Reader) (io.ReadCloser, error) {
+		xzReader, err := xz.NewReader(reader)
+		return ioutil.NopCloser(xzReader), err
+	},
+	"zstd": func(reader io.Reader) (io.ReadCloser, error) {
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	},
+}
+
+var archiveFormats = map[string]func(content []byte, budget *Budget, yield func(Member)) error{
+	"tar": func(content []byte, budget *Budget, yield func(Member)) error {
+		return unpackTar(bytes.NewReader(content), budget, yield)
+	},
+	"zip": unpackZip,
+	"7z":  unpack7z,
+	"ar":  unpackAr,
+	"rpm": unpackRPM,
+}
+
+// IsSupported tells whether the files inside an archive of this format can be extracted
+func IsSupported(format string) bool {
+	_, isStream := streamFormats[format]
+	_, isArchive := archiveFormats[format]
+	return isStream || isArchive
+}
+
+// Unpack extracts the members of an archive (name is only used to name the member of stream formats).
+// depth is the number of archives the archive is nested in. Members are yielded as soon as they are extracted,
+// so even when an error is returned, the members extracted before it have been yielded.
+func Unpack(name string, format string, content []byte, depth int, budget *Budget, yield func(Member)) error {
+	if depth >= budget.limits.MaxDepth {
+		return &LimitError{fmt.Sprintf("more than %v nested archives", budget.limits.MaxDepth)}
+	}
+
+	if unpackArchive, isArchive := archiveFormats[format]; isArchive {
+		return unpackArchive(content, budget, yield)
+	}
+
+	newReader, isStream := streamFormats[format]
+
+	if !isStream {
+		return errors.New(fmt.Sprintf("can't unpack '%s' archives", format))
+	}
+
+	reader, err := newReader(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	// .tar.gz and such are seen as a single archive, the tarball is not kept in memory
+	buffered := bufio.NewReader(reader)
+
+	if header, _ := buffered.Peek(tarHeaderSize); isTar(header) {
+		return unpackTar(buffered, budget, yield)
+	}
+
+	decompressed, err := budget.read(buffered)
+	if err != nil {
+		return err
+	}
+
+	yield(Member{Name: strings.TrimSuffix(path.Base(name), path.Ext(name)), Content: decompressed})
+	return nil
+}
+
+// The "ustar" magic ends at offset 262
+const tarHeaderSize = 262
+
+func isTar(header []byte) bool {
+	return len(header) >= tarHeaderSize && string(header[257:262]) == "ustar"
+}
+
+// read extracts a member as long as the limits are not exceeded
+func (budget *Budget) read(reader io.Reader) ([]byte, error) {
+	budget.files++
+
+	if budget.files > budget.limits.MaxFiles {
+		return nil, &LimitError{fmt.Sprintf("more than %v files", budget.limits.MaxFiles)}
+	}
+
+	maxRatioSize := int64(budget.limits.MaxRatio * float64(budget.archiveSize))
+
+	if maxRatioSize < ratioFloor {
+		maxRatioSize = ratioFloor
+	}
+
+	remaining := budget.limits.MaxSize - budget.size
+
+	if maxRatioSize-budget.size < remaining {
+		remaining = maxRatioSize - budget.size
+	}
+
+	// One more byte to know whether the limit is exceeded
+	content, err := ioutil.ReadAll(io.LimitReader(reader, remaining+1))
+	budget.size += int64(len(content))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if budget.size > budget.limits.MaxSize {
+		return nil, &LimitError{fmt.Sprintf("more than %v bytes once extracted", budget.limits.MaxSize)}
+	}
+
+	if budget.size > maxRatioSize {
+		return nil, &LimitError{fmt.Sprintf("compression ratio above %v", budget.limits.MaxRatio)}
+	}
+
+	return content, nil
+}
+
+// Members are named after their path in the archive, without the leading "./" or "/"
+func memberName(name string) string {
+	return strings.TrimLeft(path.Clean("/"+name), "/")
+}
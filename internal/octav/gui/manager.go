@@ -3,7 +3,8 @@ package gui
 import (
 	"fmt"
 	"github.com/OctAVProject/OctAV/internal/octav/core"
-	"github.com/OctAVProject/OctAV/internal/octav/core/analysis"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/static"
+	"github.com/OctAVProject/OctAV/internal/octav/core/history"
 	"github.com/OctAVProject/OctAV/internal/octav/logger"
 	"github.com/jcmuller/gozenity"
 	"github.com/zserge/lorca"
@@ -17,9 +18,11 @@ import (
 var guiMutex sync.Mutex
 var currentAnalysis *core.Analysis
 
+const historyLimit = 500
+
 func GetFilesBeingAnalysed() []string {
 	if currentAnalysis != nil {
-		return currentAnalysis.Files
+		return currentAnalysis.GetFiles()
 	} else {
 		return []string{} // empty array
 	}
@@ -33,7 +36,7 @@ func ChooseFiles() []string {
 func LaunchAnalysis(files []string) {
 	guiMutex.Lock()
 
-	if currentAnalysis == nil || !currentAnalysis.IsRunning {
+	if currentAnalysis == nil || !currentAnalysis.Running() {
 		currentAnalysis = &core.Analysis{Files: files}
 		guiMutex.Unlock()
 
@@ -46,32 +49,34 @@ func LaunchAnalysis(files []string) {
 	}
 }
 
-func GetDetectedMalwares() []analysis.Executable {
-	var malwares []analysis.Executable
+func GetDetectedMalwares() []core.Detection {
+	return core.GetDetectedMalwares()
+}
 
-	for _, malware := range core.DetectedMalwares {
-		malwares = append(malwares, *malware)
+func RemoveMalware(filepath string) string {
+	if err := core.QuarantineMalware(filepath); err != nil {
+		logger.Error(err.Error())
+		return err.Error()
 	}
 
-	return malwares
+	logger.Info(filepath + " quarantined !")
+	return ""
 }
 
-func RemoveMalware(filepath string) {
-	var newMalwareArray []*analysis.Executable
+func GetHistory() []history.Record {
+	records, err := core.GetHistory(historyLimit)
 
-	for _, malware := range core.DetectedMalwares {
-		if malware.Filename != filepath {
-			newMalwareArray = append(newMalwareArray, malware)
-		}
+	if err != nil {
+		logger.Error(err.Error())
+		return []history.Record{}
 	}
 
-	core.DetectedMalwares = newMalwareArray
-	logger.Info(filepath + " deleted !")
+	return records
 }
 
 func IsAnalysisRunning() bool {
 	if currentAnalysis != nil {
-		return currentAnalysis.IsRunning
+		return currentAnalysis.Running()
 	} else {
 		return false
 	}
@@ -79,7 +84,7 @@ func IsAnalysisRunning() bool {
 
 func GetLogs() []core.LogEntry {
 	if currentAnalysis != nil {
-		return currentAnalysis.Logs
+		return currentAnalysis.GetLogs()
 	} else {
 		return []core.LogEntry{}
 	}
@@ -90,12 +95,45 @@ func GetProgress() float64 {
 	defer guiMutex.Unlock()
 
 	if currentAnalysis != nil {
-		return currentAnalysis.Progress
+		return currentAnalysis.GetProgress()
 	} else {
 		return 0.
 	}
 }
 
+func GetSkippedCount() int {
+	guiMutex.Lock()
+	defer guiMutex.Unlock()
+
+	if currentAnalysis != nil {
+		return currentAnalysis.GetSkipped()
+	} else {
+		return 0
+	}
+}
+
+// FileIOCs are the IOCs found in a file, for the triage
+type FileIOCs struct {
+	Filename string
+	IOCs     *static.IOCs
+}
+
+func GetIOCs() []FileIOCs {
+	fileIOCs := []FileIOCs{}
+
+	if currentAnalysis == nil {
+		return fileIOCs
+	}
+
+	for _, result := range currentAnalysis.GetResults() {
+		if result.IOCs != nil {
+			fileIOCs = append(fileIOCs, FileIOCs{result.Filename, result.IOCs})
+		}
+	}
+
+	return fileIOCs
+}
+
 func CreateGUIBindings() error {
 	args := []string{"--class=Lorca"}
 
@@ -139,6 +177,14 @@ func CreateGUIBindings() error {
 		return err
 	}
 
+	if err = ui.Bind("getSkippedCount", GetSkippedCount); err != nil {
+		return err
+	}
+
+	if err = ui.Bind("getIOCs", GetIOCs); err != nil {
+		return err
+	}
+
 	if err = ui.Bind("getDetectedMalwares", GetDetectedMalwares); err != nil {
 		return err
 	}
@@ -147,6 +193,10 @@ func CreateGUIBindings() error {
 		return err
 	}
 
+	if err = ui.Bind("getHistory", GetHistory); err != nil {
+		return err
+	}
+
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		return err
@@ -0,0 +1,97 @@
+package report
+
+import (
+	"github.com/OctAVProject/OctAV/internal/octav/core"
+	"html/template"
+	"io"
+	"time"
+)
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>OctAV report</title>
+    <style>
+        body { font-family: sans-serif; margin: 2em; }
+        table { border-collapse: collapse; margin-bottom: 1em; }
+        td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+        .malicious { color: #c00; }
+        .error { color: #b60; }
+        .suspicious { color: #b60; }
+        .clean { color: #080; }
+    </style>
+</head>
+<body>
+<h1>OctAV report</h1>
+<p>Generated on {{.GeneratedAt.Format "2006-01-02 15:04:05"}}, {{.Analysed}} files analysed, {{.Skipped}} skipped.</p>
+{{range .Results}}{{if ne .Verdict "skipped"}}
+<h2 class="{{.Verdict}}">{{.Filename}} : {{.Verdict}}</h2>
+<table>
+    {{with .Process}}<tr><th>Process</th><td>PID {{.PID}}{{if .Deleted}}, deleted executable{{end}}{{if .Replaced}}, replaced executable{{end}}</td></tr>
+    <tr><th>Command line</th><td>{{.Cmdline}}</td></tr>
+    {{else}}<tr><th>Type</th><td>{{.FileType}} ({{.MIME}})</td></tr>{{end}}
+    {{if .Package}}<tr><th>Package</th><td>{{.Package}}{{if .Trusted}}, unchanged since its installation{{end}}</td></tr>{{end}}
+    <tr><th>MD5</th><td>{{.MD5}}</td></tr>
+    <tr><th>SHA1</th><td>{{.SHA1}}</td></tr>
+    <tr><th>SHA256</th><td>{{.SHA256}}</td></tr>
+    <tr><th>SSDeep</th><td>{{.SSDeep}}</td></tr>
+    {{if .TLSH}}<tr><th>TLSH</th><td>{{.TLSH}}</td></tr>{{end}}
+    {{if .ImportHash}}<tr><th>Import hash</th><td>{{.ImportHash}}</td></tr>{{end}}
+    <tr><th>Score</th><td>{{.Score.Total}} (static {{.Score.StaticTotal}}, dynamic {{.Score.DynamicTotal}})</td></tr>
+    <tr><th>Action</th><td>{{.Action}}</td></tr>
+</table>
+{{if .Score.Findings}}
+<table>
+    <tr><th>Stage</th><th>Rule</th><th>Evidence</th><th>Weight</th></tr>
+    {{range .Score.Findings}}<tr><td>{{.Stage}}</td><td>{{.RuleID}}</td><td>{{.Evidence}}</td><td>+{{.Weight}}</td></tr>
+    {{end}}
+    <tr><th colspan="3">Total</th><th>{{.Score.Total}}</th></tr>
+</table>
+{{end}}
+{{with .IOCs}}
+<p>IOCs :</p>
+<table>
+    {{if .URLs}}<tr><th>URLs</th><td>{{range .URLs}}{{.}}<br>{{end}}</td></tr>{{end}}
+    {{if .IPs}}<tr><th>IPs</th><td>{{range .IPs}}{{.}}<br>{{end}}</td></tr>{{end}}
+    {{if .Domains}}<tr><th>Domains</th><td>{{range .Domains}}{{.}}<br>{{end}}</td></tr>{{end}}
+    {{if .Emails}}<tr><th>Emails</th><td>{{range .Emails}}{{.}}<br>{{end}}</td></tr>{{end}}
+    {{if .Wallets}}<tr><th>Wallets</th><td>{{range .Wallets}}{{.}}<br>{{end}}</td></tr>{{end}}
+    {{if .Paths}}<tr><th>Paths</th><td>{{range .Paths}}{{.}}<br>{{end}}</td></tr>{{end}}
+    {{if .Commands}}<tr><th>Commands</th><td>{{range .Commands}}{{.}}<br>{{end}}</td></tr>{{end}}
+    {{if .Base64}}<tr><th>Base64 blobs</th><td>{{range .Base64}}{{.}}<br>{{end}}</td></tr>{{end}}
+</table>
+{{end}}
+{{if .YaraMatches}}
+<p>YARA matches :</p>
+<ul>{{range .YaraMatches}}<li>[{{.Namespace}}] {{.Rule}}{{range .Tags}} <em>{{.}}</em>{{end}}{{with index .Meta "description"}} : {{.}}{{end}}
+    {{if .Strings}}<ul>{{range .Strings}}<li>{{.Name}} at 0x{{printf "%x" .Offset}} : <code>{{.Snippet}}</code></li>{{end}}</ul>{{end}}
+</li>{{end}}</ul>
+{{end}}
+{{if .Errors}}
+<p class="error">Errors :</p>
+<ul>{{range .Errors}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+{{end}}{{end}}
+{{if .Skipped}}
+<h2>Skipped files</h2>
+<table>
+    <tr><th>File</th><th>Reason</th></tr>
+    {{range .Results}}{{if eq .Verdict "skipped"}}<tr><td>{{.Filename}}</td><td>{{.SkipReason}}</td></tr>
+    {{end}}{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+func writeHTML(writer io.Writer, results []*core.Result) error {
+	skipped := countSkipped(results)
+
+	return htmlTemplate.Execute(writer, struct {
+		GeneratedAt time.Time
+		Analysed    int
+		Skipped     int
+		Results     []*core.Result
+	}{time.Now(), len(results) - skipped, skipped, flatten(results)})
+}
@@ -0,0 +1,31 @@
+package report
+
+import (
+	"encoding/json"
+	"github.com/OctAVProject/OctAV/internal/octav/core"
+	"io"
+	"time"
+)
+
+type jsonReport struct {
+	Tool        string
+	GeneratedAt time.Time
+	Analysed    int
+	Skipped     int
+	Results     []*core.Result
+}
+
+func writeJSON(writer io.Writer, results []*core.Result) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	skipped := countSkipped(results)
+
+	return encoder.Encode(jsonReport{
+		Tool:        "OctAV",
+		GeneratedAt: time.Now(),
+		Analysed:    len(results) - skipped,
+		Skipped:     skipped,
+		Results:     results,
+	})
+}
@@ -0,0 +1,67 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"io"
+	"os"
+)
+
+var writers = map[string]func(io.Writer, []*core.Result) error{
+	"json":  writeJSON,
+	"sarif": writeSARIF,
+	"html":  writeHTML,
+}
+
+// Write exports the results of an analysis to filename, using one of the supported formats (json, sarif, html)
+func Write(filename string, format string, results []*core.Result) error {
+	writer, supported := writers[format]
+
+	if !supported {
+		return errors.New(fmt.Sprintf("report format '%s' is not supported", format))
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err = writer(file, results); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Report written to %s (%v files, %v skipped)", filename, len(results), countSkipped(results)))
+	return nil
+}
+
+// Skipped files are part of the results so they can be listed, but they are not counted as analysed
+func countSkipped(results []*core.Result) int {
+	skipped := 0
+
+	for _, result := range results {
+		if result.Verdict == core.VerdictSkipped {
+			skipped++
+		}
+	}
+
+	return skipped
+}
+
+// The members of archives are listed right after their archive, as "archive!member"
+func flatten(results []*core.Result) []*core.Result {
+	var flattened []*core.Result
+
+	for _, result := range results {
+		flattened = append(flattened, result)
+		flattened = append(flattened, flatten(result.Members)...)
+	}
+
+	return flattened
+}
@@ -0,0 +1,183 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core"
+	"github.com/OctAVProject/OctAV/internal/octav/core/scoring"
+	"io"
+	"net/url"
+	"path/filepath"
+)
+
+// Minimal subset of the SARIF 2.1.0 format, see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+	Properties  map[string]int    `json:"properties"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+func writeSARIF(writer io.Writer, results []*core.Result) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "OctAV",
+			InformationURI: "https://github.com/OctAVProject/OctAV",
+			Rules:          []sarifRule{{ID: "verdict", ShortDescription: sarifMessage{Text: "Final verdict on the file"}}},
+		}},
+		Invocations: []sarifInvocation{{ExecutionSuccessful: true}},
+		Results:     []sarifResult{},
+	}
+
+	skipped := countSkipped(results)
+	run.Properties = map[string]int{"analysed": len(results) - skipped, "skipped": skipped}
+
+	knownRules := map[string]bool{"verdict": true}
+
+	for _, result := range flatten(results) {
+		locations := []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: fileURI(result.Filename)},
+		}}}
+
+		for _, errStr := range result.Errors {
+			run.Invocations[0].ToolExecutionNotifications = append(run.Invocations[0].ToolExecutionNotifications, sarifNotification{
+				Level:     "error",
+				Message:   sarifMessage{Text: errStr},
+				Locations: locations,
+			})
+		}
+
+		for _, finding := range result.Score.Findings {
+			if !knownRules[finding.RuleID] {
+				knownRules[finding.RuleID] = true
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+					ID:               finding.RuleID,
+					ShortDescription: sarifMessage{Text: finding.Stage + " analysis rule " + finding.RuleID},
+				})
+			}
+
+			run.Results = append(run.Results, sarifResult{
+				RuleID:     finding.RuleID,
+				Level:      "note",
+				Message:    sarifMessage{Text: finding.Evidence},
+				Locations:  locations,
+				Properties: map[string]interface{}{"stage": finding.Stage, "weight": finding.Weight},
+			})
+		}
+
+		var level string
+
+		switch result.Verdict {
+		case scoring.Malicious:
+			level = "error"
+		case scoring.Suspicious:
+			level = "warning"
+		default:
+			continue
+		}
+
+		properties := map[string]interface{}{
+			"md5":          result.MD5,
+			"sha1":         result.SHA1,
+			"sha256":       result.SHA256,
+			"ssdeep":       result.SSDeep,
+			"tlsh":         result.TLSH,
+			"importHash":   result.ImportHash,
+			"staticScore":  result.Score.StaticTotal,
+			"dynamicScore": result.Score.DynamicTotal,
+			"score":        result.Score.Total,
+			"action":       result.Action,
+		}
+
+		if result.IOCs != nil {
+			properties["iocs"] = result.IOCs
+		}
+
+		if len(result.YaraMatches) > 0 {
+			properties["yaraMatches"] = result.YaraMatches
+		}
+
+		run.Results = append(run.Results, sarifResult{
+			RuleID:     "verdict",
+			Level:      level,
+			Message:    sarifMessage{Text: fmt.Sprintf("%s : %s", result.Filename, result.Score.Summary())},
+			Locations:  locations,
+			Properties: properties,
+		})
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+func fileURI(filename string) string {
+	if absolutePath, err := filepath.Abs(filename); err == nil {
+		filename = absolutePath
+	}
+
+	// Spaces, "#", "%" and non ASCII characters must be percent-encoded
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
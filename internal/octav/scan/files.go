@@ -3,61 +3,53 @@ package scan
 import (
 	"fmt"
 	"github.com/OctAVProject/OctAV/internal/octav/core"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/integrity"
 	"github.com/OctAVProject/OctAV/internal/octav/logger"
-	"os"
-	"path/filepath"
-	"strings"
 )
 
-func FullScan() {
+// The modified system binaries are flagged, the other ones are still analysed
+func FullScan() []*core.Result {
 	fmt.Println("Full scan starting...")
-	scanDirectory("/")
+
+	analysis := &core.Analysis{Packages: integrity.Load(systemPath())}
+	return scanDirectories(analysis, []string{"/"})
 }
 
-func FastScan() {
+// The system binaries unchanged since their installation are trusted, the modified ones are flagged
+func FastScan() []*core.Result {
 
 	directoriesToScan := []string{
 		"/home",
 		"/opt",
 	}
 
-	path := os.Getenv("PATH")
-
-	for _, directory := range strings.Split(path, ":") {
-		directoriesToScan = append(directoriesToScan, directory)
-	}
+	directoriesToScan = append(directoriesToScan, systemPath()...)
 
 	logger.Info("Fast scan starting...")
 
-	for _, directory := range directoriesToScan {
-		scanDirectory(directory)
-	}
+	analysis := &core.Analysis{Packages: integrity.Load(systemPath()), TrustPackages: true}
+	return scanDirectories(analysis, directoriesToScan)
 }
 
-func scanDirectory(directory string) {
+// The files are analysed while the directories are being walked.
+// A single walker is shared so a directory reachable from several roots (such as /bin and /usr/bin) is only scanned once.
+func scanDirectories(analysis *core.Analysis, directories []string) []*core.Result {
 
-	analysis := core.Analysis{}
+	paths := make(chan string)
 
-	err := filepath.Walk(directory, func(path string, f os.FileInfo, err error) error {
+	go func() {
+		w := newWalker(Options, directories)
 
-		// Skip directories errors (such as permission denied)
-		if f.IsDir() && err != nil {
-			return filepath.SkipDir
+		for _, directory := range directories {
+			w.walk(directory, paths)
 		}
 
-		// Analysing files
-		if !f.IsDir() {
-			analysis.Files = append(analysis.Files, path)
-		}
-
-		return err
-	})
+		close(paths)
+	}()
 
-	if err != nil {
+	if err := analysis.StartStream(paths); err != nil {
 		logger.Fatal("Directory scanning error : " + err.Error())
 	}
 
-	if err = analysis.Start(); err != nil {
-		logger.Fatal("Directory scanning error : " + err.Error())
-	}
+	return analysis.Results
 }
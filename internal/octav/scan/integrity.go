@@ -0,0 +1,53 @@
+package scan
+
+import (
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/integrity"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"os"
+	"strings"
+)
+
+// IntegrityCheck checks the files of $PATH against the package managers, only the modified ones are analysed
+func IntegrityCheck() []*core.Result {
+	logger.Header("integrity check")
+
+	packages := integrity.Load(systemPath())
+	files := packages.Files()
+	analysis := core.Analysis{Packages: packages}
+
+	for _, filename := range files {
+		intact, err := packages.Lookup(filename).Intact(filename)
+
+		if err != nil {
+			// Removed by the administrator, or not readable
+			logger.Debug(fmt.Sprintf("Can't check %s : %s", filename, err.Error()))
+			continue
+		}
+
+		if !intact {
+			analysis.Files = append(analysis.Files, filename)
+		}
+	}
+
+	logger.Info(fmt.Sprintf("%v files checked, %v modified since their installation", len(files), len(analysis.Files)))
+
+	if err := analysis.Start(); err != nil {
+		logger.Fatal("Integrity check error : " + err.Error())
+	}
+
+	return analysis.Results
+}
+
+func systemPath() []string {
+	var directories []string
+
+	for _, directory := range strings.Split(os.Getenv("PATH"), ":") {
+		if directory != "" {
+			directories = append(directories, directory)
+		}
+	}
+
+	return directories
+}
@@ -0,0 +1,690 @@
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/core"
+	"github.com/OctAVProject/OctAV/internal/octav/core/analysis/rootkit"
+	"github.com/OctAVProject/OctAV/internal/octav/core/scoring"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Stuff that could be put in a config file
+var (
+	systemCrontabs         = []string{"/etc/crontab"}
+	systemCrontabDirs      = []string{"/etc/cron.d/"}
+	userCrontabDirs        = []string{"/var/spool/cron/crontabs/", "/var/spool/cron/"}
+	cronScriptDirs         = []string{"/etc/cron.hourly/", "/etc/cron.daily/", "/etc/cron.weekly/", "/etc/cron.monthly/"}
+	systemdUnitDirs        = []string{"/etc/systemd/system/", "/run/systemd/system/", "/lib/systemd/system/", "/usr/lib/systemd/system/", "/etc/systemd/user/", "/usr/lib/systemd/user/"}
+	rcLocalPath            = "/etc/rc.local"
+	systemProfiles         = []string{"/etc/profile", "/etc/bash.bashrc", "/etc/bashrc", "/etc/zsh/zshrc", "/etc/zshrc"}
+	systemProfileDirs      = []string{"/etc/profile.d/"}
+	userProfiles           = []string{".profile", ".bashrc", ".bash_profile", ".bash_login", ".bash_logout", ".zshrc", ".zprofile"}
+	ldPreloadPath          = "/etc/ld.so.preload"
+	authorizedKeysFiles    = []string{".ssh/authorized_keys", ".ssh/authorized_keys2"}
+	udevRulesDirs          = []string{"/etc/udev/rules.d/", "/run/udev/rules.d/", "/lib/udev/rules.d/", "/usr/lib/udev/rules.d/"}
+	udevProgramDirs        = []string{"/lib/udev/", "/usr/lib/udev/"}
+	autostartDirs          = []string{"/etc/xdg/autostart/"}
+	moduleLists            = []string{"/etc/modules"}
+	moduleListDirs         = []string{"/etc/modules-load.d/", "/run/modules-load.d/", "/usr/lib/modules-load.d/"}
+	loadedModulesPath      = "/proc/modules"
+	kernelReleasePath      = "/proc/sys/kernel/osrelease"
+	kernelModulesPath      = "/lib/modules/"
+	passwdPath             = "/etc/passwd"
+	temporaryDirectories   = []string{"/tmp/", "/var/tmp/", "/dev/shm/"}
+	pseudoFilesystemPrefix = []string{"/dev/", "/proc/", "/sys/"}
+)
+
+var (
+	environmentLine  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*=`)
+	forcedCommand    = regexp.MustCompile(`command="((?:[^"\\]|\\.)*)"`)
+	udevProgram      = regexp.MustCompile(`\b(?:RUN|PROGRAM)(?:\{program\})?\+?="([^"]*)"`)
+	moduleExtensions = regexp.MustCompile(`\.ko(\.[a-z]+)?$`)
+)
+
+// Units lines starting a program, the other ones are not worth a look
+var systemdExecKeys = map[string]bool{
+	"ExecStart": true, "ExecStartPre": true, "ExecStartPost": true, "ExecReload": true, "ExecStop": true, "ExecStopPost": true,
+}
+
+// PersistenceEntry is something started automatically, such as a cron job or a systemd service
+type PersistenceEntry struct {
+	Kind    string // cron, systemd, rc.local, profile, preload, ssh, udev, autostart or module
+	Source  string // File declaring the entry
+	Command string
+	Targets []string // Files started by the entry, they are analysed
+}
+
+func (entry PersistenceEntry) String() string {
+	return fmt.Sprintf("[%s] %s : %s", entry.Kind, entry.Source, entry.Command)
+}
+
+// PersistenceScan lists the ways programs are started automatically, and analyses every file they start
+func PersistenceScan() []*core.Result {
+	logger.Header("persistence scan")
+
+	homes := homeDirectories()
+
+	var entries []PersistenceEntry
+	entries = append(entries, cronEntries()...)
+	entries = append(entries, systemdEntries(homes)...)
+	entries = append(entries, rcLocalEntries()...)
+	entries = append(entries, profileEntries(homes)...)
+	entries = append(entries, preloadEntries()...)
+	entries = append(entries, authorizedKeysEntries(homes)...)
+	entries = append(entries, udevEntries()...)
+	entries = append(entries, autostartEntries(homes)...)
+	entries = append(entries, moduleEntries()...)
+
+	analysis := core.Analysis{Findings: make(map[string][]scoring.Finding)}
+	policy := core.CurrentPolicy()
+	seen := make(map[string]bool)
+
+	for _, entry := range entries {
+		logger.Info(entry.String())
+
+		for _, target := range entry.Targets {
+			if !seen[target] {
+				seen[target] = true
+				analysis.Files = append(analysis.Files, target)
+			}
+
+			known := analysis.Findings[target]
+
+			if findings := targetFindings(entry, target, policy, known); len(findings) > 0 {
+				analysis.Findings[target] = append(known, findings...)
+			}
+		}
+	}
+
+	logger.Info(fmt.Sprintf("%v persistence entries found, starting %v files", len(entries), len(analysis.Files)))
+
+	if err := analysis.Start(); err != nil {
+		logger.Fatal("Persistence scan error : " + err.Error())
+	}
+
+	return analysis.Results
+}
+
+// targetFindings flags the targets that can be replaced by anyone, or that are started from a temporary directory.
+// A target started by several entries is only flagged once for each reason
+func targetFindings(entry PersistenceEntry, target string, policy *scoring.Policy, known []scoring.Finding) []scoring.Finding {
+	var findings []scoring.Finding
+
+	add := func(ruleID string, evidence string, weight uint) {
+		for _, finding := range known {
+			if finding.RuleID == ruleID {
+				return
+			}
+		}
+
+		findings = append(findings, scoring.Finding{Stage: scoring.StageStatic, RuleID: ruleID, Evidence: evidence, Weight: weight})
+	}
+
+	if hasAnyPrefix(target, temporaryDirectories) {
+		add("persistence.temporary_target", fmt.Sprintf("Started from a temporary directory by %s", entry), policy.Persistence.TemporaryTarget)
+	}
+
+	if isWorldWritable(target) {
+		add("persistence.writable_target", fmt.Sprintf("World-writable file started by %s", entry), policy.Persistence.WritableTarget)
+	}
+
+	if entry.Kind == "preload" {
+		add("persistence.preload", fmt.Sprintf("Preloaded into every process by %s", entry.Source), policy.Persistence.Preload)
+	}
+
+	return findings
+}
+
+// The file itself, or its directory unless the sticky bit prevents the files of others from being replaced
+func isWorldWritable(filename string) bool {
+	resolved, err := filepath.EvalSymlinks(filename)
+
+	if err != nil {
+		return false
+	}
+
+	if info, err := os.Stat(resolved); err == nil && info.Mode().Perm()&0002 != 0 {
+		return true
+	}
+
+	info, err := os.Stat(filepath.Dir(resolved))
+	return err == nil && info.Mode().Perm()&0002 != 0 && info.Mode()&os.ModeSticky == 0
+}
+
+// commandTargets returns the existing files a command refers to : the program, found in the PATH if needed, and every
+// absolute path among its arguments (scripts, libraries...)
+func commandTargets(command string, programDirs ...string) []string {
+	return referencedFiles(command, true, programDirs)
+}
+
+// pathTargets only returns the absolute paths, the lines of shell scripts start with builtins and keywords more often
+// than with programs
+func pathTargets(line string) []string {
+	return referencedFiles(line, false, nil)
+}
+
+func referencedFiles(command string, lookupProgram bool, programDirs []string) []string {
+	var targets []string
+
+	for i, field := range strings.Fields(command) {
+		field = strings.Trim(field, "\"'`();&|<>")
+
+		if field == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(field, "/") {
+			if !lookupProgram || i > 0 || strings.Contains(field, "=") {
+				continue
+			}
+
+			if field = lookProgram(field, programDirs); field == "" {
+				continue
+			}
+		}
+
+		field = filepath.Clean(field)
+
+		if hasAnyPrefix(field, pseudoFilesystemPrefix) && !hasAnyPrefix(field, temporaryDirectories) {
+			continue
+		}
+
+		info, err := os.Stat(field)
+
+		if err != nil {
+			if hasAnyPrefix(field, temporaryDirectories) {
+				logger.Danger(fmt.Sprintf("'%s' refers to %s, which doesn't exist anymore", command, field))
+			}
+
+			continue
+		}
+
+		if info.Mode().IsRegular() {
+			targets = append(targets, field)
+		}
+	}
+
+	return targets
+}
+
+func lookProgram(program string, programDirs []string) string {
+	for _, directory := range programDirs {
+		if path := filepath.Join(directory, program); FileExists(path) {
+			return path
+		}
+	}
+
+	if path, err := exec.LookPath(program); err == nil {
+		return path
+	}
+
+	return ""
+}
+
+func cronEntries() []PersistenceEntry {
+	var entries []PersistenceEntry
+
+	for _, filename := range append(append([]string{}, systemCrontabs...), listFiles(systemCrontabDirs, nil)...) {
+		entries = append(entries, crontabEntries(filename, true)...)
+	}
+
+	for _, filename := range listFiles(userCrontabDirs, nil) {
+		entries = append(entries, crontabEntries(filename, false)...)
+	}
+
+	// Scripts run by run-parts, they are the target themselves
+	for _, filename := range listFiles(cronScriptDirs, nil) {
+		entries = append(entries, PersistenceEntry{Kind: "cron", Source: filename, Command: filename, Targets: []string{filename}})
+	}
+
+	return entries
+}
+
+// System crontabs have a user field between the schedule and the command
+func crontabEntries(filename string, hasUser bool) []PersistenceEntry {
+	var entries []PersistenceEntry
+
+	for _, line := range readLines(filename) {
+		if environmentLine.MatchString(line) {
+			continue
+		}
+
+		fields := 5
+
+		if strings.HasPrefix(line, "@") { // Such as @reboot or @daily
+			fields = 1
+		}
+
+		if hasUser {
+			fields++
+		}
+
+		if command := skipFields(line, fields); command != "" {
+			entries = append(entries, PersistenceEntry{Kind: "cron", Source: filename, Command: command, Targets: commandTargets(command)})
+		}
+	}
+
+	return entries
+}
+
+func systemdEntries(homes []string) []PersistenceEntry {
+	var entries []PersistenceEntry
+
+	directories := append([]string{}, systemdUnitDirs...)
+
+	for _, home := range homes {
+		directories = append(directories, filepath.Join(home, ".config/systemd/user"))
+	}
+
+	// Drop-ins, such as foo.service.d/override.conf, can replace the commands of a unit
+	filenames := listFiles(directories, []string{".service", ".timer"})
+	filenames = append(filenames, listFiles(dropInDirectories(directories), []string{".conf"})...)
+
+	for _, filename := range filenames {
+		unitName := filepath.Base(filename)
+		isDropIn := strings.HasSuffix(filename, ".conf")
+
+		if isDropIn {
+			unitName = strings.TrimSuffix(filepath.Base(filepath.Dir(filename)), ".d")
+		}
+
+		if strings.HasSuffix(unitName, ".timer") {
+			unit := ""
+
+			for _, line := range readLines(filename) {
+				if key, value := splitKeyValue(line); key == "Unit" {
+					unit = value
+				}
+			}
+
+			// The drop-ins of a timer only matter if they change the unit it starts
+			if unit == "" && !isDropIn {
+				unit = strings.TrimSuffix(unitName, ".timer") + ".service"
+			}
+
+			if unit != "" {
+				entries = append(entries, PersistenceEntry{Kind: "systemd", Source: filename, Command: "timer starting " + unit})
+			}
+
+			continue
+		}
+
+		for _, line := range readLines(filename) {
+			key, value := splitKeyValue(line)
+
+			// An empty value resets the commands set before, such as in the unit overridden by a drop-in
+			if !systemdExecKeys[key] || value == "" {
+				continue
+			}
+
+			// Prefixes changing how the command is run, such as "-" to ignore its failure
+			command := strings.TrimLeft(value, "@-:+!")
+			entries = append(entries, PersistenceEntry{Kind: "systemd", Source: filename, Command: command, Targets: commandTargets(command)})
+		}
+	}
+
+	return entries
+}
+
+func dropInDirectories(unitDirectories []string) []string {
+	var directories []string
+
+	for _, unitDirectory := range unitDirectories {
+		entries, err := ioutil.ReadDir(unitDirectory)
+
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			directory := filepath.Join(unitDirectory, entry.Name())
+
+			if info, err := os.Stat(directory); err == nil && info.IsDir() && hasAnySuffix(entry.Name(), []string{".service.d", ".timer.d"}) {
+				directories = append(directories, directory)
+			}
+		}
+	}
+
+	return directories
+}
+
+func rcLocalEntries() []PersistenceEntry {
+	if !FileExists(rcLocalPath) {
+		return nil
+	}
+
+	entries := []PersistenceEntry{{Kind: "rc.local", Source: rcLocalPath, Command: rcLocalPath, Targets: []string{rcLocalPath}}}
+
+	for _, line := range readLines(rcLocalPath) {
+		if targets := pathTargets(line); len(targets) > 0 {
+			entries = append(entries, PersistenceEntry{Kind: "rc.local", Source: rcLocalPath, Command: line, Targets: targets})
+		}
+	}
+
+	return entries
+}
+
+// Only the lines of the profiles referring to an existing file are kept, the others are mostly variables and aliases
+func profileEntries(homes []string) []PersistenceEntry {
+	var entries []PersistenceEntry
+
+	filenames := append(append([]string{}, systemProfiles...), listFiles(systemProfileDirs, nil)...)
+
+	for _, home := range homes {
+		for _, profile := range userProfiles {
+			filenames = append(filenames, filepath.Join(home, profile))
+		}
+	}
+
+	for _, filename := range filenames {
+		for _, line := range readLines(filename) {
+			if targets := pathTargets(line); len(targets) > 0 {
+				entries = append(entries, PersistenceEntry{Kind: "profile", Source: filename, Command: line, Targets: targets})
+			}
+		}
+	}
+
+	return entries
+}
+
+func preloadEntries() []PersistenceEntry {
+	var entries []PersistenceEntry
+
+	content, err := ioutil.ReadFile(ldPreloadPath)
+
+	if err != nil {
+		return entries
+	}
+
+	// Parsed the same way as the rootkit check does
+	for _, library := range rootkit.ParsePreloadFile(content) {
+		entry := PersistenceEntry{Kind: "preload", Source: ldPreloadPath, Command: library}
+
+		if info, err := os.Stat(library); err == nil && info.Mode().IsRegular() {
+			entry.Targets = []string{library}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Every key is listed, the forced commands are analysed
+func authorizedKeysEntries(homes []string) []PersistenceEntry {
+	var entries []PersistenceEntry
+
+	for _, home := range homes {
+		for _, authorizedKeys := range authorizedKeysFiles {
+			filename := filepath.Join(home, authorizedKeys)
+
+			for _, line := range readLines(filename) {
+				entry := PersistenceEntry{Kind: "ssh", Source: filename, Command: describeKey(line)}
+
+				if match := forcedCommand.FindStringSubmatch(line); match != nil {
+					entry.Command = strings.Replace(match[1], `\"`, `"`, -1)
+					entry.Targets = commandTargets(entry.Command)
+				}
+
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries
+}
+
+// The key itself is long and meaningless, its type and its comment are enough
+func describeKey(line string) string {
+	fields := strings.Fields(line)
+
+	for i, field := range fields {
+		if strings.HasPrefix(field, "ssh-") || strings.HasPrefix(field, "ecdsa-") || strings.HasPrefix(field, "sk-") {
+			return "key " + strings.Join(append([]string{field}, fields[minInt(i+2, len(fields)):]...), " ")
+		}
+	}
+
+	return "key"
+}
+
+func udevEntries() []PersistenceEntry {
+	var entries []PersistenceEntry
+
+	for _, filename := range listFiles(udevRulesDirs, []string{".rules"}) {
+		for _, line := range readLines(filename) {
+			for _, match := range udevProgram.FindAllStringSubmatch(line, -1) {
+				entries = append(entries, PersistenceEntry{Kind: "udev", Source: filename, Command: match[1], Targets: commandTargets(match[1], udevProgramDirs...)})
+			}
+		}
+	}
+
+	return entries
+}
+
+func autostartEntries(homes []string) []PersistenceEntry {
+	var entries []PersistenceEntry
+
+	directories := append([]string{}, autostartDirs...)
+
+	for _, home := range homes {
+		directories = append(directories, filepath.Join(home, ".config/autostart"))
+	}
+
+	for _, filename := range listFiles(directories, []string{".desktop"}) {
+		for _, line := range readLines(filename) {
+			if key, value := splitKeyValue(line); key == "Exec" {
+				entries = append(entries, PersistenceEntry{Kind: "autostart", Source: filename, Command: value, Targets: commandTargets(value)})
+			}
+		}
+	}
+
+	return entries
+}
+
+// The loaded modules and the ones loaded at boot, the files are found through the modules.dep of the running kernel
+func moduleEntries() []PersistenceEntry {
+	var entries []PersistenceEntry
+
+	moduleFiles := installedModules()
+
+	add := func(source string, name string) {
+		entry := PersistenceEntry{Kind: "module", Source: source, Command: name}
+
+		if moduleFile, found := moduleFiles[normalizeModuleName(name)]; found {
+			entry.Targets = []string{moduleFile}
+		} else {
+			logger.Warning(fmt.Sprintf("Kernel module %s (%s) isn't part of the running kernel", name, source))
+		}
+
+		entries = append(entries, entry)
+	}
+
+	for _, line := range readLines(loadedModulesPath) {
+		add(loadedModulesPath, strings.Fields(line)[0])
+	}
+
+	for _, filename := range append(append([]string{}, moduleLists...), listFiles(moduleListDirs, []string{".conf"})...) {
+		for _, line := range readLines(filename) {
+			add(filename, strings.Fields(line)[0])
+		}
+	}
+
+	return entries
+}
+
+func installedModules() map[string]string {
+	modules := make(map[string]string)
+
+	release, err := ioutil.ReadFile(kernelReleasePath)
+
+	if err != nil {
+		logger.Error("Can't find the running kernel : " + err.Error())
+		return modules
+	}
+
+	directory := filepath.Join(kernelModulesPath, strings.TrimSpace(string(release)))
+
+	// Lines are "kernel/path/module.ko: dependencies..."
+	for _, line := range readLines(filepath.Join(directory, "modules.dep")) {
+		if separator := strings.IndexByte(line, ':'); separator != -1 {
+			path := line[:separator]
+			modules[normalizeModuleName(filepath.Base(path))] = filepath.Join(directory, path)
+		}
+	}
+
+	return modules
+}
+
+// Dashes and underscores are the same in module names
+func normalizeModuleName(name string) string {
+	return strings.Replace(moduleExtensions.ReplaceAllString(name, ""), "-", "_", -1)
+}
+
+// homeDirectories returns the existing home directories of the users
+func homeDirectories() []string {
+	var homes []string
+	seen := make(map[string]bool)
+
+	for _, line := range readLines(passwdPath) {
+		fields := strings.Split(line, ":")
+
+		if len(fields) < 7 || seen[fields[5]] {
+			continue
+		}
+
+		seen[fields[5]] = true
+
+		if info, err := os.Stat(fields[5]); err == nil && info.IsDir() && fields[5] != "/" {
+			homes = append(homes, fields[5])
+		}
+	}
+
+	return homes
+}
+
+// listFiles returns the files of the directories having one of the extensions (any if nil). Directories such as
+// /lib and /usr/lib are often the same, every file is only listed once
+func listFiles(directories []string, extensions []string) []string {
+	var filenames []string
+	seen := make(map[string]bool)
+
+	for _, directory := range directories {
+		entries, err := ioutil.ReadDir(directory)
+
+		if err != nil {
+			continue // Most of them only exist on some distributions
+		}
+
+		for _, entry := range entries {
+			filename := filepath.Join(directory, entry.Name())
+			info, err := os.Stat(filename) // Units are often symlinks
+
+			if err != nil || !info.Mode().IsRegular() || (extensions != nil && !hasAnySuffix(filename, extensions)) {
+				continue
+			}
+
+			resolved, err := filepath.EvalSymlinks(filename)
+
+			if err != nil || seen[resolved] {
+				continue
+			}
+
+			seen[resolved] = true
+			filenames = append(filenames, filename)
+		}
+	}
+
+	return filenames
+}
+
+// readLines returns the lines of a file that are neither empty nor comments, nothing if it doesn't exist
+func readLines(filename string) []string {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(fmt.Sprintf("Can't read %s : %s", filename, err.Error()))
+		}
+
+		return nil
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024) // authorized_keys lines can be long
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// skipFields returns what follows the first fields of a line, keeping the spaces of the rest as is
+func skipFields(line string, fields int) string {
+	for i := 0; i < fields; i++ {
+		line = strings.TrimLeft(line, " \t")
+		end := strings.IndexAny(line, " \t")
+
+		if end == -1 {
+			return ""
+		}
+
+		line = line[end:]
+	}
+
+	return strings.TrimSpace(line)
+}
+
+func splitKeyValue(line string) (string, string) {
+	separator := strings.IndexByte(line, '=')
+
+	if separator == -1 {
+		return "", ""
+	}
+
+	return strings.TrimSpace(line[:separator]), strings.TrimSpace(line[separator+1:])
+}
+
+func hasAnyPrefix(str string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(str, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasAnySuffix(str string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(str, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
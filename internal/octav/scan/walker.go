@@ -0,0 +1,251 @@
+package scan
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/OctAVProject/OctAV/internal/octav/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+type WalkOptions struct {
+	Excludes      []string // Globs matched against both the full path and the file name
+	OneFileSystem bool     // Don't cross mount points
+	MaxFileSize   int64    // In bytes, 0 means no limit
+	MaxDepth      int      // 0 means no limit
+}
+
+// Options used by the full and fast scans
+var Options WalkOptions
+
+// Filesystems that don't hold real files, or that are remote
+var skippedFilesystems = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "cgroup": true, "cgroup2": true,
+	"debugfs": true, "securityfs": true, "tracefs": true, "pstore": true, "bpf": true, "configfs": true,
+	"fusectl": true, "mqueue": true, "hugetlbfs": true, "binfmt_misc": true, "autofs": true,
+	"efivarfs": true, "rpc_pipefs": true, "nsfs": true,
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "smbfs": true, "ceph": true,
+	"glusterfs": true, "9p": true, "afs": true, "fuse.sshfs": true, "davfs": true,
+}
+
+type fileID struct {
+	device uint64
+	inode  uint64
+}
+
+type walker struct {
+	options     WalkOptions
+	mountPoints map[string]string // mount point -> filesystem type
+	visited     map[fileID]bool   // directories already walked, protects against loops and duplicates
+	followed    map[fileID]bool   // files outside the roots already reached through a symlink
+	roots       []string          // every root of the scan, symlinks resolved
+	rootDevice  uint64
+}
+
+func newWalker(options WalkOptions, roots []string) *walker {
+	w := &walker{
+		options:     options,
+		mountPoints: readMountPoints(),
+		visited:     make(map[fileID]bool),
+		followed:    make(map[fileID]bool),
+	}
+
+	for _, root := range roots {
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			w.roots = append(w.roots, resolved)
+		}
+	}
+
+	return w
+}
+
+// walk sends the regular files found under root as soon as they are discovered
+func (w *walker) walk(root string, paths chan<- string) {
+	info, err := os.Stat(root) // The root itself can be a symlink, such as /bin
+
+	if err != nil {
+		logger.Warning(fmt.Sprintf("Skipping %s : %s", root, err.Error()))
+		return
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return
+	}
+
+	w.rootDevice = uint64(stat.Dev)
+
+	if !info.IsDir() {
+		if w.acceptFile(root, info) {
+			paths <- root
+		}
+		return
+	}
+
+	w.walkDirectory(root, stat, 0, paths)
+}
+
+func (w *walker) walkDirectory(directory string, stat *syscall.Stat_t, depth int, paths chan<- string) {
+	id := fileID{uint64(stat.Dev), stat.Ino}
+
+	if w.visited[id] {
+		logger.Debug("Skipping " + directory + " : already visited")
+		return
+	}
+
+	w.visited[id] = true
+
+	if fsType, isMountPoint := w.mountPoints[directory]; isMountPoint && skippedFilesystems[fsType] {
+		logger.Debug(fmt.Sprintf("Skipping %s : %s filesystem", directory, fsType))
+		return
+	}
+
+	if w.options.OneFileSystem && uint64(stat.Dev) != w.rootDevice {
+		logger.Debug("Skipping " + directory + " : different filesystem")
+		return
+	}
+
+	entries, err := ioutil.ReadDir(directory)
+
+	// Permission denied and such
+	if err != nil {
+		logger.Debug(fmt.Sprintf("Skipping %s : %s", directory, err.Error()))
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(directory, entry.Name())
+
+		if w.isExcluded(path) {
+			logger.Debug("Skipping " + path + " : excluded")
+			continue
+		}
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if target, follow := w.followSymlink(path); follow {
+				paths <- target
+			}
+		} else if entry.IsDir() {
+			if w.options.MaxDepth > 0 && depth+1 >= w.options.MaxDepth {
+				logger.Debug("Skipping " + path + " : max depth reached")
+				continue
+			}
+
+			if entryStat, ok := entry.Sys().(*syscall.Stat_t); ok {
+				w.walkDirectory(path, entryStat, depth+1, paths)
+			}
+		} else if w.acceptFile(path, entry) {
+			paths <- path
+		}
+	}
+}
+
+// Symlinks to files outside the roots are followed, such as /usr/local/bin/x -> /tmp/x. The other targets are found
+// by walking the roots, and the directories are not followed
+func (w *walker) followSymlink(path string) (string, bool) {
+	target, err := filepath.EvalSymlinks(path) // Fails on loops
+
+	if err != nil {
+		logger.Debug(fmt.Sprintf("Skipping %s : %s", path, err.Error()))
+		return "", false
+	}
+
+	if w.isInRoots(target) || w.isExcluded(target) {
+		return "", false
+	}
+
+	info, err := os.Stat(target)
+
+	if err != nil || !w.acceptFile(target, info) {
+		return "", false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return "", false
+	}
+
+	id := fileID{uint64(stat.Dev), stat.Ino}
+
+	if w.followed[id] {
+		return "", false
+	}
+
+	w.followed[id] = true
+	return target, true
+}
+
+func (w *walker) isInRoots(path string) bool {
+	for _, root := range w.roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *walker) acceptFile(path string, info os.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return false
+	}
+
+	if w.options.MaxFileSize > 0 && info.Size() > w.options.MaxFileSize {
+		logger.Debug(fmt.Sprintf("Skipping %s : too big (%v bytes)", path, info.Size()))
+		return false
+	}
+
+	return true
+}
+
+func (w *walker) isExcluded(path string) bool {
+	for _, pattern := range w.options.Excludes {
+		if matches, _ := filepath.Match(pattern, path); matches {
+			return true
+		}
+
+		if matches, _ := filepath.Match(pattern, filepath.Base(path)); matches {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The 5th field of mountinfo is the mount point, the filesystem type comes right after the "-" separator
+func readMountPoints() map[string]string {
+	mountPoints := make(map[string]string)
+
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		logger.Warning("Can't list the mount points : " + err.Error())
+		return mountPoints
+	}
+
+	defer file.Close() // No need to handle error, file in read only
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		for i := 6; i < len(fields)-1; i++ {
+			if fields[i] == "-" && len(fields) > 4 {
+				mountPoints[unescapeMountPoint(fields[4])] = fields[i+1]
+				break
+			}
+		}
+	}
+
+	return mountPoints
+}
+
+// Spaces and such are octal escaped in mountinfo
+func unescapeMountPoint(mountPoint string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(mountPoint)
+}